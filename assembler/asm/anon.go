@@ -0,0 +1,49 @@
+package asm
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/skatsuta/nand2tetris/assembler/symbtbl"
+)
+
+// isAnonRef reports whether s is a reference to an anonymous label such as 1f or 1b,
+// which refers to the nearest label (1) forward or backward respectively.
+func isAnonRef(s string) bool {
+	n := len(s) - 1
+	return n > 0 && (s[n] == 'f' || s[n] == 'b') && symbtbl.IsAnonLabel(s[:n])
+}
+
+// anonLabel is a definition of an anonymous label.
+type anonLabel struct {
+	seq  int     // number of anonymous labels defined before it
+	addr uintptr // ROM address the label points at
+}
+
+// defineAnon adds an anonymous label symb pointing at the ROM address addr.
+func (a *Asm) defineAnon(symb string, addr uintptr) {
+	a.anon[symb] = append(a.anon[symb], anonLabel{seq: a.anonSeq, addr: addr})
+	a.anonSeq++
+}
+
+// anonAddr returns the ROM address referred by ref, such as 1f or 1b, at the current command.
+// A forward reference fails if the label is not defined yet.
+func (a *Asm) anonAddr(ref string) (int, error) {
+	symb, dir := ref[:len(ref)-1], ref[len(ref)-1]
+	labels := a.anon[symb]
+
+	// index of the first label after the current command
+	i := sort.Search(len(labels), func(i int) bool {
+		return labels[i].seq >= a.anonSeq
+	})
+	if dir == 'b' {
+		if i == 0 {
+			return 0, fmt.Errorf("no preceding label (%s) for %s", symb, ref)
+		}
+		return int(labels[i-1].addr), nil
+	}
+	if i == len(labels) {
+		return 0, fmt.Errorf("no following label (%s) for %s", symb, ref)
+	}
+	return int(labels[i].addr), nil
+}
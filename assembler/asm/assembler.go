@@ -1,110 +1,516 @@
 package asm
 
 import (
-	"bytes"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"strconv"
+	"sort"
+	"strings"
 
 	"github.com/skatsuta/nand2tetris/assembler/code"
+	"github.com/skatsuta/nand2tetris/assembler/obj"
 	"github.com/skatsuta/nand2tetris/assembler/parser"
 	"github.com/skatsuta/nand2tetris/assembler/symbtbl"
 )
 
 const (
-	bitLen = 16
+	// DefaultMaxErrors is the default limit of the number of diagnostics.
+	DefaultMaxErrors = 10
+	// romSize is the number of words in ROM.
+	romSize = 0x8000
 )
 
 // Asm is an Hack assembler.
+//
+// Asm parses the source code only once. An A instruction which refers to a symbol
+// not defined yet is emitted as a placeholder and patched after the whole source is read.
 type Asm struct {
-	err  error
-	data []byte
-	p    *parser.Parser
-	c    *code.Code
-	st   *symbtbl.SymbolTable
+	err     error
+	errs    parser.ErrorList
+	warns   parser.ErrorList
+	list    []listEntry
+	words   []uint16
+	pos     []parser.Pos // source position of each word
+	format  Format
+	maxErrs int
+	file    string
+	p       *parser.Parser
+	c       *code.Code
+	st      *symbtbl.SymbolTable
+
+	site    parser.Site // site of the command being assembled or patched
+	pc      int         // index of the word being assembled or patched
+	fixups  []fixup     // A instructions to be patched
+	globals []global    // .global directives
+
+	// label definitions
+	labels map[string]parser.Pos // positions where labels are defined
+	folded map[string]string     // labels keyed by their lower case names
+
+	// anonymous labels
+	anon    map[string][]anonLabel // anonymous labels in order
+	anonSeq int                    // number of anonymous labels defined before the current command
+
+	// relocatable object
+	reloc   bool
+	exports map[string]uint16
+	externs map[string]bool
+	imports []string
+	relocs  []obj.Reloc
+}
+
+// fixup is an A instruction whose operand refers to a symbol defined after it.
+type fixup struct {
+	symb    string      // operand of the instruction
+	index   int         // index of the word
+	list    int         // index of the listing entry
+	site    parser.Site // site of the instruction
+	anonSeq int         // number of anonymous labels defined before the instruction
+}
+
+// global is a .global directive, which is handled after all labels are defined.
+type global struct {
+	args []string
+	site parser.Site
 }
 
 // New creates a new Asm object that converts `in` to a Hack binary code.
+// The input is read while the program is assembled.
 func New(in io.Reader) (*Asm, error) {
-	data, err := ioutil.ReadAll(in)
-	if err != nil {
-		return nil, fmt.Errorf("asm.New: %s", err.Error())
-	}
+	return &Asm{
+		maxErrs: DefaultMaxErrors,
+		format:  hackFormat{},
+		p:       parser.NewParser(in),
+		c:       &code.Code{},
+		st:      symbtbl.NewSymbolTable(),
+	}, nil
+}
 
-	a := &Asm{
-		data: data,
-		p:    parser.NewParser(bytes.NewBuffer(data)),
-		c:    &code.Code{},
-		st:   symbtbl.NewSymbolTable(),
-	}
-	return a, nil
+// SetFileName sets the name of the source file, which is used in diagnostics.
+func (a *Asm) SetFileName(name string) {
+	a.file = name
+	a.p.SetFileName(name)
+}
+
+// SetIncludePaths sets directories to search for files included by .include directive.
+func (a *Asm) SetIncludePaths(dirs []string) {
+	a.p.SetIncludePaths(dirs)
+}
+
+// SetMaxErrors sets the maximum number of diagnostics reported by Run.
+// If n <= 0, the number is unlimited.
+func (a *Asm) SetMaxErrors(n int) {
+	a.maxErrs = n
+}
+
+// SetFormat sets the output format of Run. The default format is "hack".
+func (a *Asm) SetFormat(f Format) {
+	a.format = f
+}
+
+// SetStrict sets whether a accepts only C instructions in the official form,
+// which rejects white spaces and relaxed spellings such as M+D or DM=M.
+func (a *Asm) SetStrict(strict bool) {
+	a.p.SetStrict(strict)
+	a.c.SetStrict(strict)
+}
+
+// SetExtended sets whether a accepts the shift instructions in the extended instruction set,
+// which are encoded with the prefix 101 instead of 111.
+func (a *Asm) SetExtended(extended bool) {
+	a.p.SetExtended(extended)
+	a.c.SetExtended(extended)
+}
+
+// SetRelocatable makes Run write a relocatable object file instead of machine code
+// in the output format, which is combined with other objects by the linker.
+func (a *Asm) SetRelocatable(reloc bool) {
+	a.reloc = reloc
 }
 
 // DefineSymbols adds pre-defined symbols into the assembler.
 func (a *Asm) DefineSymbols(sym map[string]uintptr) {
 	a.st.AddEntries(sym)
+	a.p.DefineSymbols(sym)
+}
+
+// SymbolTable returns the symbol table of a. After Run succeeds, it holds
+// all the labels and variables in the program as well as the pre-defined symbols.
+func (a *Asm) SymbolTable() *symbtbl.SymbolTable {
+	return a.st
+}
+
+// Warnings returns the warnings found by Run, such as a label which shadows
+// a pre-defined symbol. Unlike errors, warnings do not stop the assembly.
+func (a *Asm) Warnings() parser.ErrorList {
+	return a.warns
 }
 
 // Run converts a Hack assembly code that `a` holds to a Hack binary code
 // and write it into out.
+//
+// Run does not stop at the first invalid command but goes on to collect
+// all the diagnostics up to the limit set by SetMaxErrors. If any error is found,
+// it returns them as a parser.ErrorList and writes nothing into out.
+//
+// If a is relocatable, Run writes a relocatable object in JSON instead, where
+// labels are relative to the beginning of the program and variables are left
+// to the linker.
 func (a *Asm) Run(out io.Writer) error {
-	//=== first loop: only creating a symbol table ===//
-	for a.p.HasMoreCommands() {
-		if e := a.p.Advance(); e != nil {
-			return fmt.Errorf("asm: %s", e.Error())
-		}
-
-		// first loop focuses on label commands, so skip the others
-		if a.p.CommandType() != parser.LCommand {
-			continue
-		}
+	words, err := a.Assemble()
+	if err != nil {
+		return err
+	}
 
-		// add label symbol and next ROM address
-		a.st.AddEntry(a.p.Symbol(), a.p.ROMAddr()+1)
+	write := a.format.Write
+	if a.reloc {
+		write = a.writeObject
+	}
+	if e := write(out, words); e != nil {
+		return fmt.Errorf("failed to write output: %s", e.Error())
 	}
+	return nil
+}
+
+// Assemble converts a Hack assembly code that `a` holds to machine code and returns it.
+// It reports errors in the same way as Run.
+func (a *Asm) Assemble() ([]uint16, error) {
+	a.errs = nil
+	a.warns = nil
+	a.list = nil
+	a.words = nil
+	a.pos = nil
+	a.fixups = nil
+	a.globals = nil
+	a.labels = make(map[string]parser.Pos)
+	a.folded = make(map[string]string)
+	a.anon = make(map[string][]anonLabel)
+	a.anonSeq = 0
+	a.exports = make(map[string]uint16)
+	a.externs = make(map[string]bool)
+	a.imports = nil
+	a.relocs = nil
 
-	//=== second loop: parsing entire code ===//
-	a.p = parser.NewParser(bytes.NewBuffer(a.data))
 	for a.p.HasMoreCommands() {
 		if e := a.p.Advance(); e != nil {
-			return fmt.Errorf("asm: %s", e.Error())
+			if a.addErr(e) {
+				return nil, a.errs
+			}
+			continue
 		}
+		a.site = a.p.Site()
 
-		var (
-			b   int
-			err error
-		)
+		var err error
 		switch a.p.CommandType() {
 		case parser.LCommand:
-			// skip a label command
-			continue
+			// add label symbol and next ROM address
+			a.addListing(a.p.ROMAddr()+1, 0, false)
+			err = a.defineLabel(a.p.Symbol(), a.p.ROMAddr()+1)
+		case parser.DCommand:
+			a.addListing(a.p.ROMAddr()+1, 0, false)
+			err = a.directive(a.p.Directive(), a.p.Args())
 		case parser.ACommand:
-			symb := a.p.Symbol()
-			if b, err = strconv.Atoi(symb); err != nil {
-				// add the symbol only if it is not an integer and is not contained yet in symbol table
-				if !a.st.Contains(symb) {
-					a.st.AddVar(symb)
-				}
-				// if symbol is not an integer, get its address from symbol table
-				b = int(a.st.GetAddress(symb))
-			}
+			err = a.assembleA(a.p.Symbol())
 		case parser.CCommand:
-			if b, err = a.formatCCmd(a.p.Dest(), a.p.Comp(), a.p.Jump()); err != nil {
-				return fmt.Errorf("failed to parse command: %s", err.Error())
-			}
+			err = a.assembleC(a.p.Dest(), a.p.Comp(), a.p.Jump())
 		}
+		if err != nil && a.addErr(err) {
+			return nil, a.errs
+		}
+	}
+	if e := a.p.Err(); e != nil {
+		return nil, fmt.Errorf("failed to read input: %s", e.Error())
+	}
+
+	a.backpatch()
 
-		if e := a.write(out, b); e != nil {
-			return fmt.Errorf("failed to write output: %s", e.Error())
+	// refuse to output if any error is found
+	if len(a.errs) > 0 {
+		return nil, a.errs
+	}
+	return a.words, nil
+}
+
+// assembleA assembles an A instruction whose operand is symb.
+// If symb refers to a symbol not defined yet, the word is patched later.
+func (a *Asm) assembleA(symb string) error {
+	if err := a.emit(0); err != nil {
+		return err
+	}
+
+	if a.deferred(symb) {
+		a.fixups = append(a.fixups, fixup{
+			symb:    symb,
+			index:   a.pc,
+			list:    len(a.list) - 1,
+			site:    a.site,
+			anonSeq: a.anonSeq,
+		})
+		return nil
+	}
+	return a.patch(len(a.list)-1, symb)
+}
+
+// assembleC assembles a C instruction.
+func (a *Asm) assembleC(dest, comp, jump string) error {
+	b, err := a.formatCCmd(dest, comp, jump)
+	if err != nil {
+		return a.errorf("", "failed to parse command: %s", err.Error())
+	}
+	return a.emit(uint16(b))
+}
+
+// emit appends an instruction word and its listing entry, and sets a.pc to its index.
+func (a *Asm) emit(word uint16) error {
+	var err error
+	// report only the first instruction beyond ROM
+	if len(a.words) == romSize {
+		err = a.errorf("", "program exceeds ROM size of %d words", romSize)
+	}
+	a.pc = len(a.words)
+	a.words = append(a.words, word)
+	a.pos = append(a.pos, a.site.Pos())
+	a.addListing(a.p.ROMAddr(), word, true)
+	return err
+}
+
+// deferred reports whether the operand symb refers to a symbol which is not defined yet
+// and may be defined later, in which case the word is patched after the whole source is read.
+func (a *Asm) deferred(symb string) bool {
+	switch {
+	case isExpr(symb):
+		missing := false
+		_, _ = evalExpr(symb, func(s string) (operand, bool) {
+			x, found := a.lookup(s)
+			missing = missing || !found
+			return x, found
+		})
+		return missing
+	case isAnonRef(symb):
+		_, err := a.anonAddr(symb)
+		return err != nil && symb[len(symb)-1] == 'f'
+	}
+
+	if _, isNum, err := parseNumber(symb); isNum || err != nil {
+		return false
+	}
+	return !a.st.Contains(symb) && !a.externs[symb]
+}
+
+// patch sets the value of the operand symb to the word a.pc and its listing entry list.
+func (a *Asm) patch(list int, symb string) error {
+	v, err := a.value(symb)
+	if err != nil {
+		tok := symb
+		if e, ok := err.(*exprError); ok {
+			tok = e.tok
 		}
+		return a.errorf(tok, "%s", err.Error())
 	}
+	a.words[a.pc] = uint16(v)
+	a.list[list].word = uint16(v)
 	return nil
 }
 
+// backpatch patches the A instructions which refer to symbols defined after them,
+// and then handles .global directives. The symbols still undefined become variables
+// in order of appearance.
+func (a *Asm) backpatch() {
+	for _, f := range a.fixups {
+		a.site, a.pc, a.anonSeq = f.site, f.index, f.anonSeq
+		if e := a.patch(f.list, f.symb); e != nil && a.addErr(e) {
+			return
+		}
+	}
+
+	for _, g := range a.globals {
+		a.site = g.site
+		if e := a.export(g.args); e != nil && a.addErr(e) {
+			return
+		}
+	}
+}
+
+// writeObject writes words into w as a relocatable object.
+func (a *Asm) writeObject(w io.Writer, words []uint16) error {
+	// relocations of the patched words are recorded last
+	sort.Slice(a.relocs, func(i, j int) bool {
+		return a.relocs[i].Index < a.relocs[j].Index
+	})
+
+	o := &obj.Object{
+		Name:    a.file,
+		Words:   words,
+		Exports: a.exports,
+		Imports: a.imports,
+		Relocs:  a.relocs,
+	}
+	return o.Write(w)
+}
+
+// defineLabel adds a label symb pointing at the ROM address addr into the symbol table.
+// It is an error to define a label twice.
+func (a *Asm) defineLabel(symb string, addr uintptr) error {
+	if symbtbl.IsAnonLabel(symb) {
+		a.defineAnon(symb, addr)
+		return nil
+	}
+	if k, found := a.st.Kind(symb); found {
+		switch k {
+		case symbtbl.Constant:
+			return a.errorf(symb, "label %s is already defined as a constant", symb)
+		case symbtbl.Label:
+			e := a.errorf(symb, "label %s redefined", symb)
+			// copy the notes, which may be shared with other diagnostics
+			e.Notes = append(e.Notes[:len(e.Notes):len(e.Notes)],
+				parser.Note{Pos: a.labels[symb], Msg: "previous definition of " + symb})
+			return e
+		case symbtbl.Predefined:
+			a.warnf(symb, "label %s shadows a pre-defined symbol", symb)
+		}
+	}
+	if a.externs[symb] {
+		return a.errorf(symb, "label %s is already declared as external", symb)
+	}
+	a.st.AddEntry(symb, addr)
+	a.labels[symb] = a.site.Pos()
+	a.folded[strings.ToLower(symb)] = symb
+	return nil
+}
+
+// value returns the value loaded by an A instruction whose operand is symb,
+// which is a numeric literal, a symbol or a constant expression.
+// If symb is a symbol that is not defined yet, it is added as a new variable.
+//
+// If a is relocatable, it also records the relocation of the word a.pc.
+func (a *Asm) value(symb string) (int, error) {
+	if isExpr(symb) {
+		x, err := evalExpr(symb, a.lookup)
+		if err != nil || !a.reloc {
+			return x.v, err
+		}
+		if !x.relocatable() {
+			return 0, &exprError{symb, fmt.Sprintf("expression %s is not relocatable", symb)}
+		}
+		if x.rel == 1 {
+			a.addReloc(obj.RelocROM, "")
+		}
+		return x.v, nil
+	}
+
+	if isAnonRef(symb) {
+		v, err := a.anonAddr(symb)
+		if err == nil && a.reloc {
+			a.addReloc(obj.RelocROM, "")
+		}
+		return v, err
+	}
+
+	v, isNum, err := parseNumber(symb)
+	if err != nil || isNum {
+		return v, err
+	}
+
+	if a.externs[symb] {
+		// resolved by the linker
+		a.addReloc(obj.RelocSymbol, symb)
+		return 0, nil
+	}
+
+	if strings.ContainsAny(symb, " \t") {
+		return 0, fmt.Errorf("invalid symbol %s", symb)
+	}
+
+	// add the symbol only if it is not a number and is not contained yet in symbol table
+	if !a.st.Contains(symb) {
+		if label, found := a.folded[strings.ToLower(symb)]; found {
+			a.warnf(symb, "variable %s differs from label %s only in case", symb, label)
+		}
+		if e := a.st.AddVar(symb); e != nil {
+			return 0, e
+		}
+	}
+	if a.reloc {
+		switch k, _ := a.st.Kind(symb); k {
+		case symbtbl.Label:
+			a.addReloc(obj.RelocROM, "")
+		case symbtbl.Variable:
+			// variables are allocated by the linker
+			a.addReloc(obj.RelocSymbol, symb)
+			return 0, nil
+		}
+	}
+	// if symbol is not a number, get its address from symbol table
+	v = int(a.st.GetAddress(symb))
+	if v > maxConst {
+		return 0, fmt.Errorf("address %d of %s out of range (0..%d)", v, symb, maxConst)
+	}
+	return v, nil
+}
+
+// addReloc records a relocation of the word a.pc.
+func (a *Asm) addReloc(kind obj.RelocKind, symb string) {
+	a.relocs = append(a.relocs, obj.Reloc{Index: a.pc, Kind: kind, Symbol: symb})
+}
+
+// lookup returns the value of symb in the symbol table as an operand of a constant expression.
+func (a *Asm) lookup(symb string) (operand, bool) {
+	if isAnonRef(symb) {
+		v, err := a.anonAddr(symb)
+		return operand{v: v, rel: 1}, err == nil
+	}
+	if a.externs[symb] {
+		return operand{norel: true}, true
+	}
+	if !a.st.Contains(symb) {
+		return operand{}, false
+	}
+
+	x := operand{v: int(a.st.GetAddress(symb))}
+	switch k, _ := a.st.Kind(symb); k {
+	case symbtbl.Label:
+		x.rel = 1
+	case symbtbl.Variable:
+		// the address of a variable is unknown until linked
+		x.norel = a.reloc
+	}
+	return x, true
+}
+
+// addErr adds err to the diagnostics a holds. If the number of diagnostics
+// has already reached the limit, it drops err, adds a "too many errors" diagnostic
+// at the position of err instead and returns true.
+func (a *Asm) addErr(err error) bool {
+	e, ok := err.(*parser.Error)
+	if !ok {
+		e = a.errorf("", "%s", err.Error())
+	}
+
+	if a.maxErrs <= 0 || len(a.errs) < a.maxErrs {
+		a.errs = append(a.errs, e)
+		return false
+	}
+	a.errs = append(a.errs, &parser.Error{Pos: e.Pos, Msg: "too many errors"})
+	return true
+}
+
+// errorf returns a diagnostic about tok in the command being assembled or patched.
+func (a *Asm) errorf(tok string, format string, args ...interface{}) *parser.Error {
+	return a.site.Errorf(tok, format, args...)
+}
+
+// warnf adds a warning about tok in the command being assembled or patched.
+func (a *Asm) warnf(tok string, format string, args ...interface{}) {
+	w := a.errorf(tok, format, args...)
+	w.Warning = true
+	a.warns = append(a.warns, w)
+}
+
 // formatCCmd formats dest, comp and jump mneumonics into one machine code.
 // If the arguments contain an invalid mneumonic, it returns an error.
 func (a *Asm) formatCCmd(dest, comp, jump string) (int, error) {
+	// clear the error of the previous command
+	a.err = nil
+
 	dbyt, err := a.c.Dest(dest)
 	a.setErr(err)
 	cbyt, err := a.c.Comp(comp)
@@ -117,7 +523,12 @@ func (a *Asm) formatCCmd(dest, comp, jump string) (int, error) {
 	}
 
 	// C instruction: 111 0000000(comp) 000(dest) 000(jump)
-	return int(0x7)<<13 | int(cbyt)<<6 | int(dbyt)<<3 | int(jbyt), nil
+	// extended instruction: 101 0000000(comp) 000(dest) 000(jump)
+	prefix := code.PrefixC
+	if a.c.IsExtended(comp) {
+		prefix = code.PrefixExt
+	}
+	return prefix<<13 | int(cbyt)<<6 | int(dbyt)<<3 | int(jbyt), nil
 }
 
 // setErr sets err only if a.err is nil. This method is used for holding the first error.
@@ -127,10 +538,3 @@ func (a *Asm) setErr(err error) {
 	}
 	a.err = err
 }
-
-// write writes binary format of i into out.
-func (a *Asm) write(out io.Writer, i int) error {
-	_, e := fmt.Fprintf(out, "%0"+strconv.Itoa(bitLen)+"b\n", i)
-	return e
-
-}
@@ -2,8 +2,17 @@ package asm
 
 import (
 	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/skatsuta/nand2tetris/assembler/obj"
+	"github.com/skatsuta/nand2tetris/assembler/parser"
+	"github.com/skatsuta/nand2tetris/assembler/symbtbl"
 )
 
 // test assembly code
@@ -102,6 +111,12 @@ func TestRun(t *testing.T) {
 	}{
 		{"@1", "0000000000000001\n"},
 		{"@256", "0000000100000000\n"},
+		{"@0x4000", "0100000000000000\n"},
+		{"@0b101", "0000000000000101\n"},
+		{"@'A'", "0000000001000001\n"},
+		{"@32767", "0111111111111111\n"},
+		{"@LABEL+2\n(LABEL)\n@LABEL-1", "0000000000000011\n0000000000000000\n"},
+		{"@i\n@(i + 1) * 2", "0000000000010000\n0000000000100010\n"},
 		{"(LOOP)", ""},
 		{"(END)", ""},
 		{"A=!A", "1110110001100000\n"},
@@ -111,6 +126,7 @@ func TestRun(t *testing.T) {
 		{"AM=D&A;JLE", "1110000000101110\n"},
 		{"@i\n@j", "0000000000010000\n0000000000010001\n"},
 		{"(LOOP)\nD=0\n@LOOP", "1110101010010000\n0000000000000000\n"},
+		{"D=0\n(LOOP)\n@ LOOP", "1110101010010000\n0000000000000001\n"},
 		{"@32\nM=1\n@a\nMD=-1",
 			"0000000000100000\n1110111111001000\n0000000000010000\n1110111010011000\n"},
 		{"@LABEL\n0;JMP\n@a\nM=1\n(LABEL)\n@b",
@@ -141,3 +157,606 @@ func TestRun(t *testing.T) {
 		}
 	}
 }
+
+func TestRunExtended(t *testing.T) {
+	src := "D=D<<\nM=M>>\nA=A<<;JNE"
+	want := "1010110000010000\n1011000000001000\n1010100000100101\n"
+
+	asmblr, err := New(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("New failed: %s", err.Error())
+	}
+	asmblr.SetExtended(true)
+	var out bytes.Buffer
+	if e := asmblr.Run(&out); e != nil {
+		t.Fatalf("%s", e.Error())
+	}
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	// shifts are rejected by default
+	asmblr, _ = New(strings.NewReader(src))
+	if e := asmblr.Run(ioutil.Discard); e == nil {
+		t.Errorf("shift instructions should be rejected without the extended instruction set")
+	}
+}
+
+func TestRunError(t *testing.T) {
+	runErrorTests := []struct {
+		src  string
+		want string
+	}{
+		{"@1\nD=D*A", "Foo.asm:2:3: invalid comp command: \"D*A\""},
+		{"@1\n\n  (LOOP", "Foo.asm:3:7: label command should be closed with ')', but got P"},
+		{"D=M\n  @40000 // too large", "Foo.asm:2:4: constant 40000 out of range (0..32767)"},
+		{"@-1", "Foo.asm:1:2: constant -1 out of range (0..32767)"},
+		{"(LOOP)\n@LOOP + FOO", "Foo.asm:2:9: undefined symbol FOO in expression LOOP + FOO"},
+		{"@A B", "Foo.asm:1:2: invalid symbol A B"},
+	}
+
+	for _, tt := range runErrorTests {
+		asmblr, err := New(strings.NewReader(tt.src))
+		if err != nil {
+			t.Fatalf("New failed: %s", err.Error())
+		}
+		asmblr.SetFileName("Foo.asm")
+
+		var out bytes.Buffer
+		err = asmblr.Run(&out)
+		if err == nil {
+			t.Fatalf("src %q: Run should fail", tt.src)
+		}
+		if got := err.Error(); got != tt.want {
+			t.Errorf("got: %q; want: %q", got, tt.want)
+		}
+	}
+}
+
+func TestRunErrorList(t *testing.T) {
+	src := "D=D*A\n@1\nX=0\n(LOOP\n0;JJ\nD=M\nM=-2\n"
+
+	runErrorListTests := []struct {
+		maxErrs int
+		want    []string
+	}{
+		{0, []string{
+			`1:3: invalid comp command: "D*A"`,
+			`3:1: invalid dest command: X`,
+			`4:5: label command should be closed with ')', but got P`,
+			`5:3: invalid jump command: JJ`,
+			`7:3: invalid comp command: "-2"`,
+		}},
+		{2, []string{
+			`1:3: invalid comp command: "D*A"`,
+			`3:1: invalid dest command: X`,
+			`4:5: too many errors`,
+		}},
+		// no error is dropped
+		{5, []string{
+			`1:3: invalid comp command: "D*A"`,
+			`3:1: invalid dest command: X`,
+			`4:5: label command should be closed with ')', but got P`,
+			`5:3: invalid jump command: JJ`,
+			`7:3: invalid comp command: "-2"`,
+		}},
+	}
+
+	for _, tt := range runErrorListTests {
+		asmblr, err := New(strings.NewReader(src))
+		if err != nil {
+			t.Fatalf("New failed: %s", err.Error())
+		}
+		asmblr.SetMaxErrors(tt.maxErrs)
+
+		var out bytes.Buffer
+		err = asmblr.Run(&out)
+		list, ok := err.(parser.ErrorList)
+		if !ok {
+			t.Fatalf("got %#v; want parser.ErrorList", err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("nothing should be written, but got %q", out.String())
+		}
+
+		if len(list) != len(tt.want) {
+			t.Fatalf("the number of errors should be %d, but got %d: %v", len(tt.want), len(list), list)
+		}
+		for i, e := range list {
+			if e.Error() != tt.want[i] {
+				t.Errorf("error %d: got %q; want %q", i, e.Error(), tt.want[i])
+			}
+		}
+	}
+}
+
+func TestWriteListing(t *testing.T) {
+	src := "// comment\n@LABEL\n0;JMP\n(LABEL)\n  @i  // variable\n\tM=1\n"
+	want := `ROM   HEX   BINARY             LINE  SOURCE
+00000 0002  0000000000000010      2  @LABEL
+00001 EA87  1110101010000111      3  0;JMP
+00002                             4  (LABEL)
+00002 0010  0000000000010000      5    @i  // variable
+00003 EFC8  1110111111001000      6  	M=1
+`
+
+	asmblr, err := New(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("New failed: %s", err.Error())
+	}
+	if e := asmblr.Run(&bytes.Buffer{}); e != nil {
+		t.Fatalf("Run failed: %s", e.Error())
+	}
+
+	var out bytes.Buffer
+	if e := asmblr.WriteListing(&out); e != nil {
+		t.Fatalf("WriteListing failed: %s", e.Error())
+	}
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestWriteListingOrigin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lib := filepath.Join(dir, "lib.asm")
+	if e := ioutil.WriteFile(lib, []byte("@0\nINC j\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	src := ".macro INC x\n\t@x\n\tM=M+1\n.endm\n.include \"lib.asm\"\nINC i\n"
+	want := "ROM   HEX   BINARY             LINE  SOURCE\n" +
+		fmt.Sprintf("00000 0000  0000000000000000  %s:1  @0\n", lib) +
+		fmt.Sprintf("00001 0010  0000000000010000  %s:2  \t@j\n", lib) +
+		fmt.Sprintf("00002 FDC8  1111110111001000  %s:2  \tM=M+1\n", lib) +
+		"00003 0011  0000000000010001      6  \t@i\n" +
+		"00004 FDC8  1111110111001000      6  \tM=M+1\n"
+
+	asmblr, err := New(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("New failed: %s", err.Error())
+	}
+	asmblr.SetFileName(filepath.Join(dir, "main.asm"))
+	if e := asmblr.Run(&bytes.Buffer{}); e != nil {
+		t.Fatalf("Run failed: %s", e.Error())
+	}
+
+	var out bytes.Buffer
+	if e := asmblr.WriteListing(&out); e != nil {
+		t.Fatalf("WriteListing failed: %s", e.Error())
+	}
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestEqu(t *testing.T) {
+	src := `.equ WIDTH 32
+.equ ROW SCREEN + WIDTH * 2  // the 2nd row
+@WIDTH
+D=A
+@ROW
+M=D
+@i
+.equ LAST 0x7FFF
+@LAST
+(END)
+@END+1
+`
+	want := "0000000000100000\n1110110000010000\n0100000001000000\n1110001100001000\n" +
+		"0000000000010000\n0111111111111111\n0000000000000111\n"
+
+	asmblr, err := New(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("New failed: %s", err.Error())
+	}
+	asmblr.DefineSymbols(map[string]uintptr{"SCREEN": 0x4000, "R0": 0x0})
+
+	var out bytes.Buffer
+	if e := asmblr.Run(&out); e != nil {
+		t.Fatalf("Run failed: %s", e.Error())
+	}
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+	if k, _ := asmblr.SymbolTable().Kind("WIDTH"); k != symbtbl.Constant {
+		t.Errorf("WIDTH should be a constant, but got %v", k)
+	}
+}
+
+func TestEquError(t *testing.T) {
+	equErrorTests := []struct {
+		src  string
+		want string
+	}{
+		{".equ WIDTH 32\n.equ WIDTH 64", "2:6: constant WIDTH redefined"},
+		{"(LOOP)\n.equ LOOP 1", "2:6: constant LOOP is already defined as a label"},
+		{".equ LOOP 1\n(LOOP)", "2:2: label LOOP is already defined as a constant"},
+		{".equ R0 1", "1:6: cannot redefine pre-defined symbol R0"},
+		{".equ 1X 1", "1:6: invalid constant name: 1X"},
+		{".equ X", "1:2: usage: .equ NAME value"},
+		{".equ X Y+1\n(Y)", "1:8: undefined symbol Y in expression Y+1"},
+		{".equ X 40000", "1:8: constant 40000 out of range (0..32767)"},
+		{".foo 1", "1:2: unknown directive: .foo"},
+		{".", "1:1: missing directive name"},
+	}
+
+	for _, tt := range equErrorTests {
+		asmblr, err := New(strings.NewReader(tt.src))
+		if err != nil {
+			t.Fatalf("New failed: %s", err.Error())
+		}
+		asmblr.DefineSymbols(map[string]uintptr{"R0": 0x0})
+
+		err = asmblr.Run(&bytes.Buffer{})
+		if err == nil {
+			t.Fatalf("src %q: Run should fail", tt.src)
+		}
+		if got := err.Error(); got != tt.want {
+			t.Errorf("src %q: got %q; want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestRunMacro(t *testing.T) {
+	src := `.macro GOTO_IF_ZERO label
+	@label
+	D;JEQ
+.endm
+.macro COUNTDOWN n
+	@n
+	D=A
+(LOOP)
+	D=D-1
+	GOTO_IF_ZERO END
+	@LOOP
+	0;JMP
+.endm
+	COUNTDOWN 2
+	COUNTDOWN 3
+(END)
+`
+	want := "0000000000000010\n1110110000010000\n1110001110010000\n0000000000001110\n1110001100000010\n" +
+		"0000000000000010\n1110101010000111\n" +
+		"0000000000000011\n1110110000010000\n1110001110010000\n0000000000001110\n1110001100000010\n" +
+		"0000000000001001\n1110101010000111\n"
+
+	asmblr, err := New(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("New failed: %s", err.Error())
+	}
+
+	var out bytes.Buffer
+	if e := asmblr.Run(&out); e != nil {
+		t.Fatalf("Run failed: %s", e.Error())
+	}
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRunRelocatable(t *testing.T) {
+	src := `.extern MULT
+.global START, END
+.equ N 3
+(START)
+	@N
+	D=A
+	@x
+	M=D
+	@MULT
+	0;JMP
+(END)
+	@END+1
+	@SCREEN
+	@x
+`
+	asmblr, err := New(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("New failed: %s", err.Error())
+	}
+	asmblr.SetFileName("main.asm")
+	asmblr.SetRelocatable(true)
+	asmblr.DefineSymbols(map[string]uintptr{"SCREEN": 0x4000})
+
+	var buf bytes.Buffer
+	if e := asmblr.Run(&buf); e != nil {
+		t.Fatalf("Run failed: %s", e.Error())
+	}
+	got, err := obj.Read(&buf)
+	if err != nil {
+		t.Fatalf("obj.Read failed: %s", err.Error())
+	}
+
+	want := &obj.Object{
+		Name:    "main.asm",
+		Words:   []uint16{3, 0xEC10, 0, 0xE308, 0, 0xEA87, 7, 0x4000, 0},
+		Exports: map[string]uint16{"START": 0, "END": 6},
+		Imports: []string{"MULT"},
+		Relocs: []obj.Reloc{
+			{Index: 2, Kind: obj.RelocSymbol, Symbol: "x"},
+			{Index: 4, Kind: obj.RelocSymbol, Symbol: "MULT"},
+			{Index: 6, Kind: obj.RelocROM},
+			{Index: 8, Kind: obj.RelocSymbol, Symbol: "x"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%+v\nwant:\n%+v", got, want)
+	}
+}
+
+func TestRunRelocatableError(t *testing.T) {
+	relocErrorTests := []struct {
+		src   string
+		reloc bool
+		want  string
+	}{
+		{".extern F", false, "1:2: .extern is allowed only in a relocatable object"},
+		{".extern", true, "1:2: usage: .extern NAME..."},
+		{"(F)\n.extern F", true, "2:9: external symbol F is already defined"},
+		{".extern F\n(F)", true, "2:2: label F is already declared as external"},
+		{".global F", true, "1:9: exported symbol F is not defined as a label"},
+		{".global F", false, "1:9: exported symbol F is not defined as a label"},
+		{"(L)\n@L*2", true, "2:2: expression L*2 is not relocatable"},
+		{".extern F\n@F+1", true, "2:2: expression F+1 is not relocatable"},
+		{"@x\n@x+1", true, "2:2: expression x+1 is not relocatable"},
+		{"(L)\n.equ X L+1", true, "2:8: value of constant X cannot be determined before linking"},
+	}
+
+	for _, tt := range relocErrorTests {
+		asmblr, err := New(strings.NewReader(tt.src))
+		if err != nil {
+			t.Fatalf("New failed: %s", err.Error())
+		}
+		asmblr.SetRelocatable(tt.reloc)
+
+		err = asmblr.Run(&bytes.Buffer{})
+		if err == nil {
+			t.Errorf("src %q: Run should fail", tt.src)
+			continue
+		}
+		if got := err.Error(); got != tt.want {
+			t.Errorf("src %q: got %q; want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestRunAnonLabel(t *testing.T) {
+	src := `(MULT)
+(.loop)
+	@1f
+	0;JMP
+(1)
+	@1b+1
+	@.loop
+(1)
+	@1b
+	@2f
+	@1f
+(2)
+(1)
+`
+	asmblr, err := New(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("New failed: %s", err.Error())
+	}
+	var buf bytes.Buffer
+	if e := asmblr.Run(&buf); e != nil {
+		t.Fatalf("Run failed: %s", e.Error())
+	}
+
+	want := "0000000000000010\n1110101010000111\n0000000000000011\n0000000000000000\n" +
+		"0000000000000100\n0000000000000111\n0000000000000111\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// anonymous labels are not added to the symbol table
+	if asmblr.SymbolTable().Contains("1") {
+		t.Error("anonymous label 1 should not be in the symbol table")
+	}
+	if addr := asmblr.SymbolTable().GetAddress("MULT.loop"); addr != 0 {
+		t.Errorf("MULT.loop: got = %d; want = 0", addr)
+	}
+}
+
+func TestRunAnonLabelError(t *testing.T) {
+	anonErrorTests := []struct {
+		src  string
+		want string
+	}{
+		{"@1b\n(1)", "1:2: no preceding label (1) for 1b"},
+		{"(1)\n@1f", "2:2: no following label (1) for 1f"},
+		{"@2f+1\n(1)", "1:2: undefined symbol 2f in expression 2f+1"},
+	}
+
+	for _, tt := range anonErrorTests {
+		asmblr, err := New(strings.NewReader(tt.src))
+		if err != nil {
+			t.Fatalf("New failed: %s", err.Error())
+		}
+
+		err = asmblr.Run(&bytes.Buffer{})
+		if err == nil {
+			t.Errorf("src %q: Run should fail", tt.src)
+			continue
+		}
+		if got := err.Error(); got != tt.want {
+			t.Errorf("src %q: got %q; want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestRunDuplicateLabel(t *testing.T) {
+	src := "(LOOP)\n\t@LOOP\n\t0;JMP\n  (LOOP)\n"
+
+	asmblr, err := New(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("New failed: %s", err.Error())
+	}
+	asmblr.SetFileName("a.asm")
+
+	err = asmblr.Run(&bytes.Buffer{})
+	want := "a.asm:4:4: label LOOP redefined\n\ta.asm:1:1: previous definition of LOOP"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v; want %s", err, want)
+	}
+}
+
+func TestRunWarnings(t *testing.T) {
+	src := `(R5)
+(Loop)
+	@loop
+	@R5
+	@i
+	@Loop
+`
+	asmblr, err := New(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("New failed: %s", err.Error())
+	}
+	asmblr.DefineSymbols(map[string]uintptr{"R5": 5})
+
+	var buf bytes.Buffer
+	if e := asmblr.Run(&buf); e != nil {
+		t.Fatalf("Run failed: %s", e.Error())
+	}
+
+	var got []string
+	for _, w := range asmblr.Warnings() {
+		got = append(got, w.Error())
+	}
+	want := []string{
+		"1:2: warning: label R5 shadows a pre-defined symbol",
+		"3:3: warning: variable loop differs from label Loop only in case",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q; want: %q", got, want)
+	}
+
+	// the label takes the place of the pre-defined symbol
+	wantHack := "0000000000010000\n0000000000000000\n0000000000010001\n0000000000000000\n"
+	if buf.String() != wantHack {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), wantHack)
+	}
+}
+
+func TestRunCapacity(t *testing.T) {
+	// variables up to the screen memory map
+	var src strings.Builder
+	for i := symbtbl.VarBase; i <= symbtbl.VarLimit; i++ {
+		fmt.Fprintf(&src, "@v%d\n", i)
+	}
+
+	asmblr, err := New(strings.NewReader(src.String()))
+	if err != nil {
+		t.Fatalf("New failed: %s", err.Error())
+	}
+	err = asmblr.Run(&bytes.Buffer{})
+	want := "16369:2: no RAM left for variable v16384: variables must be below SCREEN (0x4000)"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v; want %s", err, want)
+	}
+
+	// instructions beyond ROM
+	asmblr, err = New(strings.NewReader(strings.Repeat("D=0\n", romSize+2)))
+	if err != nil {
+		t.Fatalf("New failed: %s", err.Error())
+	}
+	err = asmblr.Run(&bytes.Buffer{})
+	want = "32769:1: program exceeds ROM size of 32768 words"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v; want %s", err, want)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	asmblr, err := New(strings.NewReader("@i\nM=0\n@j\nM=1\n@i\n"))
+	if err != nil {
+		t.Fatalf("New failed: %s", err.Error())
+	}
+	if e := asmblr.Run(&bytes.Buffer{}); e != nil {
+		t.Fatalf("Run failed: %s", e.Error())
+	}
+
+	u := asmblr.Usage()
+	if u != (Usage{ROM: 5, RAM: 2}) {
+		t.Errorf("got %+v; want {ROM:5 RAM:2}", u)
+	}
+	want := "ROM 5/32768 words (0.0%), RAM 2/16368 variables (0.0%)"
+	if got := u.String(); got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestRunProjects(t *testing.T) {
+	for _, name := range []string{"add/Add", "max/Max", "max/MaxL", "rect/Rect", "rect/RectL", "pong/Pong", "pong/PongL"} {
+		src, err := ioutil.ReadFile("../../projects/06/" + name + ".asm")
+		if err != nil {
+			t.Fatalf("failed to read %s.asm: %s", name, err.Error())
+		}
+		want, err := ioutil.ReadFile("../../projects/06/" + name + ".hack")
+		if err != nil {
+			t.Fatalf("failed to read %s.hack: %s", name, err.Error())
+		}
+
+		asmblr, err := New(bytes.NewReader(src))
+		if err != nil {
+			t.Fatalf("New failed: %s", err.Error())
+		}
+		asmblr.DefineSymbols(PredefinedSymbols)
+
+		var buf bytes.Buffer
+		if e := asmblr.Run(&buf); e != nil {
+			t.Errorf("%s: Run failed: %s", name, e.Error())
+			continue
+		}
+		if got := strings.Fields(buf.String()); !reflect.DeepEqual(got, strings.Fields(string(want))) {
+			t.Errorf("%s: the output differs from %s.hack", name, name)
+		}
+	}
+}
+
+func BenchmarkRunPong(b *testing.B) {
+	src, err := ioutil.ReadFile("../../projects/06/pong/Pong.asm")
+	if err != nil {
+		b.Fatalf("failed to read Pong.asm: %s", err.Error())
+	}
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		asmblr, err := New(bytes.NewReader(src))
+		if err != nil {
+			b.Fatalf("New failed: %s", err.Error())
+		}
+		asmblr.DefineSymbols(PredefinedSymbols)
+		if e := asmblr.Run(ioutil.Discard); e != nil {
+			b.Fatalf("Run failed: %s", e.Error())
+		}
+	}
+}
+
+func BenchmarkAssemblePong(b *testing.B) {
+	src, err := ioutil.ReadFile("../../projects/06/pong/Pong.asm")
+	if err != nil {
+		b.Fatalf("failed to read Pong.asm: %s", err.Error())
+	}
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		asmblr, err := New(bytes.NewReader(src))
+		if err != nil {
+			b.Fatalf("New failed: %s", err.Error())
+		}
+		asmblr.DefineSymbols(PredefinedSymbols)
+		if _, e := asmblr.Assemble(); e != nil {
+			b.Fatalf("Assemble failed: %s", e.Error())
+		}
+	}
+}
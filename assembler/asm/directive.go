@@ -0,0 +1,108 @@
+package asm
+
+import (
+	"strings"
+
+	"github.com/skatsuta/nand2tetris/assembler/symbtbl"
+)
+
+// directive handles a directive .name with arguments args.
+func (a *Asm) directive(name string, args []string) error {
+	switch name {
+	case "equ":
+		return a.equ(args)
+	case "global":
+		// checked after all labels are defined
+		a.globals = append(a.globals, global{args: args, site: a.site})
+		return nil
+	case "extern":
+		return a.extern(args)
+	}
+	return a.errorf(name, "unknown directive: .%s", name)
+}
+
+// equ handles a directive ".equ NAME value", which defines a constant symbol NAME.
+// value is a numeric literal, a symbol defined before or a constant expression.
+func (a *Asm) equ(args []string) error {
+	if len(args) < 2 {
+		return a.errorf("equ", "usage: .equ NAME value")
+	}
+
+	symb := args[0]
+	if !symbtbl.IsSymbol(symb) {
+		return a.errorf(symb, "invalid constant name: %s", symb)
+	}
+	if k, found := a.st.Kind(symb); found {
+		switch k {
+		case symbtbl.Predefined:
+			return a.errorf(symb, "cannot redefine pre-defined symbol %s", symb)
+		case symbtbl.Label:
+			return a.errorf(symb, "constant %s is already defined as a label", symb)
+		default:
+			return a.errorf(symb, "constant %s redefined", symb)
+		}
+	}
+
+	expr := strings.Join(args[1:], " ")
+	x, err := evalExpr(expr, a.lookup)
+	if err != nil {
+		e := err.(*exprError)
+		return a.errorf(e.tok, "%s", e.msg)
+	}
+	if a.reloc && (x.rel != 0 || x.norel) {
+		return a.errorf(args[1], "value of constant %s cannot be determined before linking", symb)
+	}
+	a.st.AddConst(symb, uintptr(x.v))
+	return nil
+}
+
+// splitNames splits whitespace separated arguments further at commas,
+// so that a list of names can be written as "A, B" as well as "A B".
+func splitNames(args []string) []string {
+	return strings.FieldsFunc(strings.Join(args, " "), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// extern handles a directive ".extern NAME..." in a relocatable object,
+// which declares labels defined in other objects.
+func (a *Asm) extern(args []string) error {
+	args = splitNames(args)
+	if len(args) == 0 {
+		return a.errorf("extern", "usage: .extern NAME...")
+	}
+	if !a.reloc {
+		return a.errorf("extern", ".extern is allowed only in a relocatable object")
+	}
+
+	for _, symb := range args {
+		if !symbtbl.IsSymbol(symb) {
+			return a.errorf(symb, "invalid symbol name: %s", symb)
+		}
+		if a.st.Contains(symb) {
+			return a.errorf(symb, "external symbol %s is already defined", symb)
+		}
+		if !a.externs[symb] {
+			a.externs[symb] = true
+			a.imports = append(a.imports, symb)
+		}
+	}
+	return nil
+}
+
+// export handles a directive ".global NAME..." after all labels are defined, which exports labels
+// defined in the program to other objects. It has no effect unless a is relocatable.
+func (a *Asm) export(args []string) error {
+	args = splitNames(args)
+	if len(args) == 0 {
+		return a.errorf("global", "usage: .global NAME...")
+	}
+
+	for _, symb := range args {
+		if k, found := a.st.Kind(symb); !found || k != symbtbl.Label {
+			return a.errorf(symb, "exported symbol %s is not defined as a label", symb)
+		}
+		a.exports[symb] = uint16(a.st.GetAddress(symb))
+	}
+	return nil
+}
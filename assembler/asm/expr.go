@@ -0,0 +1,234 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skatsuta/nand2tetris/assembler/symbtbl"
+)
+
+// exprOps is a set of operators and parentheses in a constant expression.
+const exprOps = "+-*&|()"
+
+// exprError is an error in a constant expression.
+type exprError struct {
+	tok string // offending token
+	msg string
+}
+
+func (e *exprError) Error() string {
+	return e.msg
+}
+
+// isExpr reports whether s is a constant expression rather than a single literal or symbol,
+// i.e. s contains an operator or a parenthesis.
+func isExpr(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'':
+			// skip a character literal
+			i += 2
+		case strings.IndexByte(exprOps, c) >= 0:
+			return true
+		}
+	}
+	return false
+}
+
+// operand is a value in a constant expression.
+type operand struct {
+	v int
+	// rel is the number of times the base address of the module is added to v.
+	// It is 1 for a label and 0 for a constant, which matters only in a relocatable object.
+	rel int
+	// norel reports whether the value cannot be relocated by the linker, e.g. it depends on
+	// a symbol resolved by the linker or applies & or | to a label.
+	norel bool
+}
+
+// relocatable reports whether x is either an absolute value or an address
+// relative to the base address of the module.
+func (x operand) relocatable() bool {
+	return !x.norel && (x.rel == 0 || x.rel == 1)
+}
+
+// evaluator evaluates a constant expression in an A instruction.
+// It supports the binary operators + - * & | and unary -, + with parentheses
+// over numeric literals and symbols. The precedence of the operators is the same as C:
+//
+//	unary -, +   (highest)
+//	*
+//	+ -
+//	&
+//	|            (lowest)
+type evaluator struct {
+	src    string
+	off    int    // offset of the next token
+	tok    string // current token
+	lookup func(symb string) (operand, bool)
+}
+
+// evalExpr evaluates the constant expression s. Symbols in s are resolved by lookup.
+// If s is malformed, contains an undefined symbol or its value is out of the range 0..32767,
+// it returns an *exprError.
+func evalExpr(s string, lookup func(symb string) (operand, bool)) (operand, error) {
+	ev := &evaluator{src: s, lookup: lookup}
+	if err := ev.next(); err != nil {
+		return operand{}, err
+	}
+
+	x, err := ev.or()
+	if err != nil {
+		return operand{}, err
+	}
+	if ev.tok != "" {
+		return operand{}, &exprError{ev.tok, fmt.Sprintf("unexpected %s in expression %s", ev.tok, s)}
+	}
+
+	if x.v < 0 || x.v > maxConst {
+		return operand{}, &exprError{s, fmt.Sprintf("constant %s out of range (0..%d)", s, maxConst)}
+	}
+	return x, nil
+}
+
+// next reads the next token into ev.tok. At the end of input, ev.tok is "".
+func (ev *evaluator) next() error {
+	for ev.off < len(ev.src) && (ev.src[ev.off] == ' ' || ev.src[ev.off] == '\t') {
+		ev.off++
+	}
+
+	start := ev.off
+	switch {
+	case ev.off == len(ev.src):
+	case strings.IndexByte(exprOps, ev.src[ev.off]) >= 0:
+		ev.off++
+	case ev.src[ev.off] == '\'':
+		ev.off += 3
+		if ev.off > len(ev.src) {
+			ev.off = len(ev.src)
+		}
+	case symbtbl.IsSymbolChar(ev.src[ev.off]):
+		for ev.off < len(ev.src) && symbtbl.IsSymbolChar(ev.src[ev.off]) {
+			ev.off++
+		}
+	default:
+		tok := ev.src[ev.off : ev.off+1]
+		return &exprError{tok, fmt.Sprintf("invalid character %s in expression %s", tok, ev.src)}
+	}
+
+	ev.tok = ev.src[start:ev.off]
+	return nil
+}
+
+// binary parses a left-associative binary operation of the operators ops
+// whose operands are parsed by parse.
+func (ev *evaluator) binary(ops string, parse func() (operand, error), apply func(op string, x, y operand) operand) (operand, error) {
+	x, err := parse()
+	if err != nil {
+		return x, err
+	}
+
+	for ev.tok != "" && strings.Contains(ops, ev.tok) {
+		op := ev.tok
+		if e := ev.next(); e != nil {
+			return x, e
+		}
+		y, err := parse()
+		if err != nil {
+			return x, err
+		}
+		x = apply(op, x, y)
+	}
+	return x, nil
+}
+
+// or parses x | y.
+func (ev *evaluator) or() (operand, error) {
+	return ev.binary("|", ev.and, func(_ string, x, y operand) operand {
+		return operand{v: x.v | y.v, norel: x.norel || y.norel || x.rel != 0 || y.rel != 0}
+	})
+}
+
+// and parses x & y.
+func (ev *evaluator) and() (operand, error) {
+	return ev.binary("&", ev.sum, func(_ string, x, y operand) operand {
+		return operand{v: x.v & y.v, norel: x.norel || y.norel || x.rel != 0 || y.rel != 0}
+	})
+}
+
+// sum parses x + y and x - y.
+func (ev *evaluator) sum() (operand, error) {
+	return ev.binary("+-", ev.term, func(op string, x, y operand) operand {
+		if op == "-" {
+			return operand{v: x.v - y.v, rel: x.rel - y.rel, norel: x.norel || y.norel}
+		}
+		return operand{v: x.v + y.v, rel: x.rel + y.rel, norel: x.norel || y.norel}
+	})
+}
+
+// term parses x * y.
+func (ev *evaluator) term() (operand, error) {
+	return ev.binary("*", ev.unary, func(_ string, x, y operand) operand {
+		return operand{
+			v:     x.v * y.v,
+			rel:   x.rel*y.v + y.rel*x.v,
+			norel: x.norel || y.norel || x.rel != 0 && y.rel != 0,
+		}
+	})
+}
+
+// unary parses -x and +x.
+func (ev *evaluator) unary() (operand, error) {
+	if ev.tok != "-" && ev.tok != "+" {
+		return ev.primary()
+	}
+
+	op := ev.tok
+	if e := ev.next(); e != nil {
+		return operand{}, e
+	}
+	x, err := ev.unary()
+	if op == "-" {
+		x.v, x.rel = -x.v, -x.rel
+	}
+	return x, err
+}
+
+// primary parses a numeric literal, a symbol or a parenthesized expression.
+func (ev *evaluator) primary() (operand, error) {
+	tok := ev.tok
+	switch {
+	case tok == "":
+		return operand{}, &exprError{ev.src, fmt.Sprintf("unexpected end of expression %s", ev.src)}
+	case tok == "(":
+		if e := ev.next(); e != nil {
+			return operand{}, e
+		}
+		x, err := ev.or()
+		if err != nil {
+			return x, err
+		}
+		if ev.tok != ")" {
+			return x, &exprError{tok, fmt.Sprintf("missing ')' in expression %s", ev.src)}
+		}
+		return x, ev.next()
+	case strings.Contains(exprOps, tok):
+		return operand{}, &exprError{tok, fmt.Sprintf("unexpected %s in expression %s", tok, ev.src)}
+	}
+
+	if !isAnonRef(tok) {
+		v, isNum, err := parseNumber(tok)
+		if err != nil {
+			return operand{}, &exprError{tok, err.Error()}
+		}
+		if isNum {
+			return operand{v: v}, ev.next()
+		}
+	}
+
+	x, found := ev.lookup(tok)
+	if !found {
+		return x, &exprError{tok, fmt.Sprintf("undefined symbol %s in expression %s", tok, ev.src)}
+	}
+	return x, ev.next()
+}
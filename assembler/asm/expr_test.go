@@ -0,0 +1,142 @@
+package asm
+
+import "testing"
+
+var exprSymbols = map[string]int{
+	"SCREEN": 0x4000,
+	"KBD":    0x6000,
+	"TABLE":  100,
+	"R1":     1,
+	"a.b$c":  7,
+}
+
+// exprLookup looks up exprSymbols, where TABLE is a label and EXT is resolved by the linker.
+func exprLookup(symb string) (operand, bool) {
+	switch symb {
+	case "TABLE":
+		return operand{v: exprSymbols[symb], rel: 1}, true
+	case "EXT":
+		return operand{norel: true}, true
+	}
+	v, found := exprSymbols[symb]
+	return operand{v: v}, found
+}
+
+func TestIsExpr(t *testing.T) {
+	isExprTests := []struct {
+		s    string
+		want bool
+	}{
+		{"SCREEN+32", true},
+		{"KBD-1", true},
+		{"(1)", true},
+		{"TABLE + 3", true},
+		{"'+'", false},
+		{"'-'+1", true},
+		{"LOOP", false},
+		{"0x4000", false},
+		{"a.b$c", false},
+		{"A B", false},
+	}
+
+	for _, tt := range isExprTests {
+		if got := isExpr(tt.s); got != tt.want {
+			t.Errorf("isExpr(%q) = %v; want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestEvalExpr(t *testing.T) {
+	evalExprTests := []struct {
+		s    string
+		want int
+	}{
+		{"SCREEN+32", 0x4020},
+		{"KBD-1", 0x5FFF},
+		{"TABLE+3", 103},
+		{"TABLE + 3 * 2", 106},
+		{"(TABLE + 3) * 2", 206},
+		{"2*3+4*5", 26},
+		{"10-4-3", 3},
+		{"0xFF&0x0F|0x30", 0x3F},
+		{"1|2&3", 3},
+		{"-1+2", 1},
+		{"--3", 3},
+		{"+5", 5},
+		{"'A'+1", 66},
+		{"0b11*R1", 3},
+		{"a.b$c*(1+(2))", 21},
+		{"KBD-SCREEN", 0x2000},
+	}
+
+	for _, tt := range evalExprTests {
+		got, err := evalExpr(tt.s, exprLookup)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.s, err.Error())
+			continue
+		}
+		if got.v != tt.want {
+			t.Errorf("%s: got = %d; want = %d", tt.s, got.v, tt.want)
+		}
+	}
+}
+
+func TestEvalExprError(t *testing.T) {
+	evalExprErrorTests := []struct {
+		s    string
+		tok  string
+		want string
+	}{
+		{"-1", "-1", "constant -1 out of range (0..32767)"},
+		{"SCREEN*2", "SCREEN*2", "constant SCREEN*2 out of range (0..32767)"},
+		{"FOO+1", "FOO", "undefined symbol FOO in expression FOO+1"},
+		{"(1+2", "(", "missing ')' in expression (1+2"},
+		{"1+", "1+", "unexpected end of expression 1+"},
+		{"1+*2", "*", "unexpected * in expression 1+*2"},
+		{"1 2", "2", "unexpected 2 in expression 1 2"},
+		{"1)", ")", "unexpected ) in expression 1)"},
+		{"1/2", "/", "invalid character / in expression 1/2"},
+		{"0x+1", "0x", "invalid numeric literal: 0x"},
+		{"40000+1", "40000", "constant 40000 out of range (0..32767)"},
+	}
+
+	for _, tt := range evalExprErrorTests {
+		_, err := evalExpr(tt.s, exprLookup)
+		e, ok := err.(*exprError)
+		if !ok {
+			t.Errorf("%s: got %#v; want *exprError", tt.s, err)
+			continue
+		}
+		if e.tok != tt.tok || e.msg != tt.want {
+			t.Errorf("%s: got = (%q, %q); want = (%q, %q)", tt.s, e.tok, e.msg, tt.tok, tt.want)
+		}
+	}
+}
+
+func TestEvalExprRelocatable(t *testing.T) {
+	relocatableTests := []struct {
+		s    string
+		rel  int
+		want bool
+	}{
+		{"SCREEN+32", 0, true},
+		{"TABLE+3", 1, true},
+		{"(TABLE+3)*1", 1, true},
+		{"TABLE-TABLE+1", 0, true},
+		{"TABLE*2", 2, false},
+		{"TABLE&0xFF", 0, false},
+		{"0-TABLE+200", -1, false},
+		{"EXT+1", 0, false},
+	}
+
+	for _, tt := range relocatableTests {
+		got, err := evalExpr(tt.s, exprLookup)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.s, err.Error())
+			continue
+		}
+		if got.rel != tt.rel || got.relocatable() != tt.want {
+			t.Errorf("%s: got = (%d, %v); want = (%d, %v)", tt.s, got.rel, got.relocatable(), tt.rel, tt.want)
+		}
+	}
+}
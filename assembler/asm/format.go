@@ -0,0 +1,160 @@
+package asm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+const (
+	bitLen = 16
+
+	// ihexRecLen is the number of data bytes in an Intel HEX record.
+	ihexRecLen = 16
+	// logisimPerLine is the number of words per line in a Logisim image.
+	logisimPerLine = 8
+)
+
+// Format is an output format of Hack machine code.
+type Format interface {
+	// Ext returns the file extension name of the format without a leading dot.
+	Ext() string
+	// Write writes words into w.
+	Write(w io.Writer, words []uint16) error
+}
+
+// formats is a map of format names and output formats.
+var formats = map[string]Format{
+	"hack":    hackFormat{},
+	"bin":     binFormat{},
+	"ihex":    ihexFormat{},
+	"logisim": logisimFormat{},
+	"mem":     memFormat{},
+}
+
+// RegisterFormat registers f as an output format named name.
+// If a format with the same name already exists, it is replaced.
+// RegisterFormat is not thread safe, so it should be called in an init function.
+func RegisterFormat(name string, f Format) {
+	formats[name] = f
+}
+
+// LookupFormat returns the output format named name.
+func LookupFormat(name string) (Format, bool) {
+	f, found := formats[name]
+	return f, found
+}
+
+// FormatNames returns the names of all the registered output formats in sorted order.
+func FormatNames() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hackFormat is the text format read by the CPU emulator.
+// Each word is written as 16 binary digits per line.
+type hackFormat struct{}
+
+func (hackFormat) Ext() string {
+	return "hack"
+}
+
+func (hackFormat) Write(w io.Writer, words []uint16) error {
+	bw := bufio.NewWriter(w)
+	for _, wd := range words {
+		fmt.Fprintf(bw, "%0"+strconv.Itoa(bitLen)+"b\n", wd)
+	}
+	return bw.Flush()
+}
+
+// binFormat is a raw binary format. Each word is written as 2 bytes in big endian.
+type binFormat struct{}
+
+func (binFormat) Ext() string {
+	return "bin"
+}
+
+func (binFormat) Write(w io.Writer, words []uint16) error {
+	return binary.Write(w, binary.BigEndian, words)
+}
+
+// ihexFormat is the Intel HEX format. Each word is stored as 2 bytes in big endian,
+// so a word at ROM address n is placed at the byte address 2n.
+type ihexFormat struct{}
+
+func (ihexFormat) Ext() string {
+	return "hex"
+}
+
+func (ihexFormat) Write(w io.Writer, words []uint16) error {
+	data := make([]byte, 2*len(words))
+	for i, wd := range words {
+		binary.BigEndian.PutUint16(data[2*i:], wd)
+	}
+
+	bw := bufio.NewWriter(w)
+	for addr := 0; addr < len(data); addr += ihexRecLen {
+		end := addr + ihexRecLen
+		if end > len(data) {
+			end = len(data)
+		}
+		writeIHexRec(bw, uint16(addr), 0x00, data[addr:end])
+	}
+	// end of file record
+	writeIHexRec(bw, 0, 0x01, nil)
+	return bw.Flush()
+}
+
+// writeIHexRec writes an Intel HEX record of the type typ into w.
+func writeIHexRec(w io.Writer, addr uint16, typ byte, data []byte) {
+	sum := byte(len(data)) + byte(addr>>8) + byte(addr) + typ
+	fmt.Fprintf(w, ":%02X%04X%02X", len(data), addr, typ)
+	for _, b := range data {
+		fmt.Fprintf(w, "%02X", b)
+		sum += b
+	}
+	fmt.Fprintf(w, "%02X\n", -sum)
+}
+
+// logisimFormat is the "v2.0 raw" image format loaded into a Logisim ROM.
+type logisimFormat struct{}
+
+func (logisimFormat) Ext() string {
+	return "rom"
+}
+
+func (logisimFormat) Write(w io.Writer, words []uint16) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "v2.0 raw")
+	for i, wd := range words {
+		sep := " "
+		if (i+1)%logisimPerLine == 0 || i == len(words)-1 {
+			sep = "\n"
+		}
+		fmt.Fprintf(bw, "%x%s", wd, sep)
+	}
+	return bw.Flush()
+}
+
+// memFormat is the memory file format read by $readmemh in Verilog.
+// Each word is written as 4 hex digits per line.
+type memFormat struct{}
+
+func (memFormat) Ext() string {
+	return "mem"
+}
+
+func (memFormat) Write(w io.Writer, words []uint16) error {
+	bw := bufio.NewWriter(w)
+	for _, wd := range words {
+		fmt.Fprintf(bw, "%04x\n", wd)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,67 @@
+package asm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormatWrite(t *testing.T) {
+	words := []uint16{0x0002, 0xEA87, 0x0010, 0xEFC8, 0x0000, 0xFC10, 0x0001, 0xF4D0, 0x000A}
+
+	formatTests := []struct {
+		name string
+		ext  string
+		want string
+	}{
+		{"hack", "hack", "0000000000000010\n1110101010000111\n0000000000010000\n1110111111001000\n" +
+			"0000000000000000\n1111110000010000\n0000000000000001\n1111010011010000\n0000000000001010\n"},
+		{"bin", "bin", "\x00\x02\xEA\x87\x00\x10\xEF\xC8\x00\x00\xFC\x10\x00\x01\xF4\xD0\x00\x0A"},
+		{"ihex", "hex", ":100000000002EA870010EFC80000FC100001F4D0E5\n:02001000000AE4\n:00000001FF\n"},
+		{"logisim", "rom", "v2.0 raw\n2 ea87 10 efc8 0 fc10 1 f4d0\na\n"},
+		{"mem", "mem", "0002\nea87\n0010\nefc8\n0000\nfc10\n0001\nf4d0\n000a\n"},
+	}
+
+	for _, tt := range formatTests {
+		f, found := LookupFormat(tt.name)
+		if !found {
+			t.Fatalf("format %s should be found", tt.name)
+		}
+		if f.Ext() != tt.ext {
+			t.Errorf("format %s: got ext = %s; want = %s", tt.name, f.Ext(), tt.ext)
+		}
+
+		var buf bytes.Buffer
+		if e := f.Write(&buf, words); e != nil {
+			t.Fatalf("format %s: Write failed: %s", tt.name, e.Error())
+		}
+		if buf.String() != tt.want {
+			t.Errorf("format %s:\ngot:  %q\nwant: %q", tt.name, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestFormatNames(t *testing.T) {
+	want := []string{"bin", "hack", "ihex", "logisim", "mem"}
+	if got := FormatNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v; want: %v", got, want)
+	}
+}
+
+func TestSetFormat(t *testing.T) {
+	asmblr, err := New(strings.NewReader("@2\n0;JMP"))
+	if err != nil {
+		t.Fatalf("New failed: %s", err.Error())
+	}
+	f, _ := LookupFormat("mem")
+	asmblr.SetFormat(f)
+
+	var out bytes.Buffer
+	if e := asmblr.Run(&out); e != nil {
+		t.Fatalf("Run failed: %s", e.Error())
+	}
+	if want := "0002\nea87\n"; out.String() != want {
+		t.Errorf("got: %q; want: %q", out.String(), want)
+	}
+}
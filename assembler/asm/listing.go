@@ -0,0 +1,55 @@
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// listEntry is an entry of a listing, which corresponds to a source line
+// of an instruction or a label definition.
+type listEntry struct {
+	addr   uintptr
+	word   uint16
+	inst   bool   // false if the entry is a label definition
+	file   string // file of the line, which differs from the main file if it is included
+	line   int    // line number, which is the call site for a macro expansion
+	source string
+}
+
+// addListing adds the current command into the listing.
+func (a *Asm) addListing(addr uintptr, word uint16, inst bool) {
+	a.list = append(a.list, listEntry{
+		addr:   addr,
+		word:   word,
+		inst:   inst,
+		file:   a.site.Origin().File,
+		line:   a.site.Origin().Line,
+		source: strings.TrimRight(a.site.Source(), " \t"),
+	})
+}
+
+// WriteListing writes a listing of the program assembled by Run into w.
+// Each line of the listing shows the ROM address, the machine code in hex and binary,
+// the line number and the source line. A label definition is shown with
+// the ROM address it points to. A line from an included file is shown with the file name,
+// and a line in a macro expansion with the line number of the macro call.
+// This method should be called after Run succeeds.
+func (a *Asm) WriteListing(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%-5s %-4s  %-16s  %5s  %s\n", "ROM", "HEX", "BINARY", "LINE", "SOURCE")
+	for _, e := range a.list {
+		line := strconv.Itoa(e.line)
+		if e.file != a.file {
+			line = e.file + ":" + line
+		}
+		if e.inst {
+			fmt.Fprintf(bw, "%05d %04X  %016b  %5s  %s\n", e.addr, e.word, e.word, line, e.source)
+		} else {
+			fmt.Fprintf(bw, "%05d %4s  %16s  %5s  %s\n", e.addr, "", "", line, e.source)
+		}
+	}
+	return bw.Flush()
+}
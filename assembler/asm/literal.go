@@ -0,0 +1,71 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxConst is the maximum value of a constant in an A instruction.
+const maxConst = 1<<(bitLen-1) - 1
+
+// parseNumber parses a numeric literal s in an A instruction.
+// The following forms are accepted:
+//
+//	123     decimal
+//	0x7B    hexadecimal
+//	0b101   binary
+//	'A'     printable ASCII character
+//
+// If s is not a numeric literal, that is, a symbol, ok is false.
+// If s is a malformed literal or its value is out of the range 0..32767, err is not nil.
+func parseNumber(s string) (v int, ok bool, err error) {
+	if s == "" {
+		return 0, false, nil
+	}
+
+	var n int64
+	switch c := s[0]; {
+	case c == '\'':
+		// only a printable ASCII character is accepted as in the Hack character set
+		if len(s) != 3 || s[2] != '\'' || s[1] < ' ' || s[1] > '~' {
+			return 0, true, fmt.Errorf("invalid character literal: %s", s)
+		}
+		n = int64(s[1])
+	case c == '-' || c == '+' || '0' <= c && c <= '9':
+		n, err = parseInt(s)
+		if e, isNumErr := err.(*strconv.NumError); isNumErr && e.Err == strconv.ErrRange {
+			return 0, true, fmt.Errorf("constant %s out of range (0..%d)", s, maxConst)
+		}
+		if err != nil {
+			return 0, true, fmt.Errorf("invalid numeric literal: %s", s)
+		}
+	default:
+		return 0, false, nil
+	}
+
+	if n < 0 || n > maxConst {
+		return 0, true, fmt.Errorf("constant %s out of range (0..%d)", s, maxConst)
+	}
+	return int(n), true, nil
+}
+
+// parseInt parses a signed decimal, hexadecimal (0x) or binary (0b) integer.
+func parseInt(s string) (int64, error) {
+	sign := ""
+	if s[0] == '-' || s[0] == '+' {
+		sign, s = s[:1], s[1:]
+	}
+
+	base := 10
+	switch lower := strings.ToLower(s); {
+	case strings.HasPrefix(lower, "0x"):
+		base, s = 16, s[2:]
+	case strings.HasPrefix(lower, "0b"):
+		base, s = 2, s[2:]
+	}
+	if s == "" || s[0] == '-' || s[0] == '+' {
+		return 0, &strconv.NumError{Func: "ParseInt", Num: s, Err: strconv.ErrSyntax}
+	}
+	return strconv.ParseInt(sign+s, base, 64)
+}
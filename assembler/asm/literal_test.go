@@ -0,0 +1,72 @@
+package asm
+
+import "testing"
+
+func TestParseNumber(t *testing.T) {
+	parseNumberTests := []struct {
+		s    string
+		want int
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"256", 256, true},
+		{"32767", 32767, true},
+		{"0x4000", 0x4000, true},
+		{"0X7fff", 0x7FFF, true},
+		{"0b101", 5, true},
+		{"0B0", 0, true},
+		{"'A'", 65, true},
+		{"' '", 32, true},
+		{"'''", 39, true},
+		{"+12", 12, true},
+		{"i", 0, false},
+		{"LOOP", 0, false},
+		{"R0", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range parseNumberTests {
+		got, ok, err := parseNumber(tt.s)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.s, err.Error())
+			continue
+		}
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: got = (%d, %v); want = (%d, %v)", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseNumberError(t *testing.T) {
+	parseNumberErrorTests := []struct {
+		s    string
+		want string
+	}{
+		{"32768", "constant 32768 out of range (0..32767)"},
+		{"40000", "constant 40000 out of range (0..32767)"},
+		{"99999999999999999999", "constant 99999999999999999999 out of range (0..32767)"},
+		{"-1", "constant -1 out of range (0..32767)"},
+		{"0x8000", "constant 0x8000 out of range (0..32767)"},
+		{"0x", "invalid numeric literal: 0x"},
+		{"0x-1", "invalid numeric literal: 0x-1"},
+		{"0b102", "invalid numeric literal: 0b102"},
+		{"12ab", "invalid numeric literal: 12ab"},
+		{"-", "invalid numeric literal: -"},
+		{"'AB'", "invalid character literal: 'AB'"},
+		{"''", "invalid character literal: ''"},
+		{"'A", "invalid character literal: 'A"},
+		{"'あ'", "invalid character literal: 'あ'"},
+		{"'\t'", "invalid character literal: '\t'"},
+	}
+
+	for _, tt := range parseNumberErrorTests {
+		_, ok, err := parseNumber(tt.s)
+		if err == nil || !ok {
+			t.Errorf("%s: should be an invalid numeric literal", tt.s)
+			continue
+		}
+		if err.Error() != tt.want {
+			t.Errorf("%s: got %q; want %q", tt.s, err.Error(), tt.want)
+		}
+	}
+}
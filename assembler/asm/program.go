@@ -0,0 +1,91 @@
+package asm
+
+import (
+	"io"
+
+	"github.com/skatsuta/nand2tetris/assembler/parser"
+	"github.com/skatsuta/nand2tetris/assembler/symbtbl"
+)
+
+// PredefinedSymbols is the pre-defined symbols of the Hack platform.
+var PredefinedSymbols = map[string]uintptr{
+	"SP":     0x0,
+	"LCL":    0x1,
+	"ARG":    0x2,
+	"THIS":   0x3,
+	"THAT":   0x4,
+	"R0":     0x0,
+	"R1":     0x1,
+	"R2":     0x2,
+	"R3":     0x3,
+	"R4":     0x4,
+	"R5":     0x5,
+	"R6":     0x6,
+	"R7":     0x7,
+	"R8":     0x8,
+	"R9":     0x9,
+	"R10":    0xA,
+	"R11":    0xB,
+	"R12":    0xC,
+	"R13":    0xD,
+	"R14":    0xE,
+	"R15":    0xF,
+	"SCREEN": 0x4000,
+	"KBD":    0x6000,
+}
+
+// Options is a set of options of Assemble.
+type Options struct {
+	// FileName is the name of the source file, which is used in diagnostics
+	// and to search for included files.
+	FileName string
+	// IncludePaths is a list of directories to search for included files.
+	IncludePaths []string
+	// MaxErrors is the maximum number of diagnostics. If it is 0, the number is unlimited.
+	MaxErrors int
+	// Symbols is pre-defined symbols. If it is nil, PredefinedSymbols is used.
+	Symbols map[string]uintptr
+	// Strict makes Assemble accept only C instructions in the official form.
+	Strict bool
+	// Extended makes Assemble accept the shift instructions in the extended instruction set.
+	Extended bool
+}
+
+// Program is a Hack program assembled by Assemble.
+type Program struct {
+	Words    []uint16             // machine code
+	Symbols  *symbtbl.SymbolTable // labels, variables, constants and pre-defined symbols
+	Pos      []parser.Pos         // source position of each word
+	Warnings parser.ErrorList
+}
+
+// Assemble assembles Hack assembly code read from src with options opts.
+// If any error is found, it returns them as a parser.ErrorList.
+func Assemble(src io.Reader, opts Options) (*Program, error) {
+	a, err := New(src)
+	if err != nil {
+		return nil, err
+	}
+	a.SetFileName(opts.FileName)
+	a.SetIncludePaths(opts.IncludePaths)
+	a.SetMaxErrors(opts.MaxErrors)
+	a.SetStrict(opts.Strict)
+	a.SetExtended(opts.Extended)
+
+	symbs := opts.Symbols
+	if symbs == nil {
+		symbs = PredefinedSymbols
+	}
+	a.DefineSymbols(symbs)
+
+	words, err := a.Assemble()
+	if err != nil {
+		return nil, err
+	}
+	return &Program{
+		Words:    words,
+		Symbols:  a.st,
+		Pos:      a.pos,
+		Warnings: a.warns,
+	}, nil
+}
@@ -0,0 +1,62 @@
+package asm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/skatsuta/nand2tetris/assembler/parser"
+)
+
+func TestAssemble(t *testing.T) {
+	src := `// sum
+	@i
+	M=1
+(LOOP)
+	@LOOP
+	0;JMP
+(R5)
+`
+	prog, err := Assemble(strings.NewReader(src), Options{FileName: "sum.asm"})
+	if err != nil {
+		t.Fatalf("Assemble failed: %s", err.Error())
+	}
+
+	wantWords := []uint16{0x10, 0xEFC8, 2, 0xEA87}
+	if !reflect.DeepEqual(prog.Words, wantWords) {
+		t.Errorf("words: got %04X; want %04X", prog.Words, wantWords)
+	}
+
+	var wantPos []parser.Pos
+	for _, line := range []int{2, 3, 5, 6} {
+		wantPos = append(wantPos, parser.Pos{File: "sum.asm", Line: line, Column: 2})
+	}
+	if !reflect.DeepEqual(prog.Pos, wantPos) {
+		t.Errorf("positions: got %v; want %v", prog.Pos, wantPos)
+	}
+
+	if addr := prog.Symbols.GetAddress("LOOP"); addr != 2 {
+		t.Errorf("LOOP: got = %d; want = 2", addr)
+	}
+	if addr := prog.Symbols.GetAddress("KBD"); addr != 0x6000 {
+		t.Errorf("KBD: got = 0x%X; want = 0x6000", addr)
+	}
+
+	if len(prog.Warnings) != 1 || prog.Warnings[0].Error() != "sum.asm:7:2: warning: label R5 shadows a pre-defined symbol" {
+		t.Errorf("unexpected warnings: %v", prog.Warnings)
+	}
+}
+
+func TestAssembleError(t *testing.T) {
+	src := strings.Repeat("D=X\n", 20)
+
+	_, err := Assemble(strings.NewReader(src), Options{Symbols: map[string]uintptr{}})
+	list, ok := err.(parser.ErrorList)
+	if !ok {
+		t.Fatalf("got %#v; want parser.ErrorList", err)
+	}
+	// the number of errors is unlimited by default
+	if len(list) != 20 {
+		t.Errorf("the number of errors should be 20, but got %d", len(list))
+	}
+}
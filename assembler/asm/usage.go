@@ -0,0 +1,30 @@
+package asm
+
+import (
+	"fmt"
+
+	"github.com/skatsuta/nand2tetris/assembler/symbtbl"
+)
+
+// Usage is the amount of memory used by a program.
+type Usage struct {
+	ROM int // number of words in ROM
+	RAM int // number of variables in RAM
+}
+
+// String returns a summary of u and the capacities of ROM and RAM.
+func (u Usage) String() string {
+	ram := symbtbl.VarLimit - symbtbl.VarBase
+	return fmt.Sprintf("ROM %d/%d words (%.1f%%), RAM %d/%d variables (%.1f%%)",
+		u.ROM, romSize, percent(u.ROM, romSize), u.RAM, ram, percent(u.RAM, ram))
+}
+
+// percent returns n / total in percent.
+func percent(n, total int) float64 {
+	return float64(n) * 100 / float64(total)
+}
+
+// Usage returns the amount of memory used by the program after Run succeeds.
+func (a *Asm) Usage() Usage {
+	return Usage{ROM: len(a.words), RAM: a.st.NumVars()}
+}
@@ -1,6 +1,17 @@
 package code
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	// PrefixC is the 3 bit prefix of a C instruction.
+	PrefixC = 0x7
+	// PrefixExt is the 3 bit prefix of an extended instruction, which shifts a register.
+	PrefixExt = 0x5
+)
 
 // instSet is a map of an opcode and a binary opcode.
 type instSet map[string]byte
@@ -11,6 +22,16 @@ func (is instSet) isValid(mneum string) bool {
 	return found
 }
 
+// mneum returns the mneumonic corresponding to the binary opcode b.
+func (is instSet) mneum(b byte) (string, bool) {
+	for m, op := range is {
+		if op == b {
+			return m, true
+		}
+	}
+	return "", false
+}
+
 var (
 	// destInstSet is a map of dest mneumonics and its binary opcodes.
 	destInstSet = instSet{
@@ -58,6 +79,17 @@ var (
 		"D|M": 0x55,
 	}
 
+	// extCompInstSet is a map of comp mneumonics in the extended instruction set and
+	// its binary opcodes, which are used with PrefixExt instead of PrefixC.
+	extCompInstSet = instSet{
+		"A<<": 0x20,
+		"D<<": 0x30,
+		"M<<": 0x60,
+		"A>>": 0x0,
+		"D>>": 0x10,
+		"M>>": 0x40,
+	}
+
 	// jumpInstSet is a map of jump mneumonics and its binary opcodes.
 	jumpInstSet instSet = map[string]byte{
 		"":    0x0,
@@ -72,44 +104,187 @@ var (
 )
 
 // Code is a converter from mneumonics to binary codes.
+//
+// By default, Code also accepts relaxed spellings of mneumonics: white spaces are ignored,
+// the registers of dest can be in any order such as MA or DM, and the operands of
+// commutative operators in comp can be swapped such as M+D, A&D or 1+D.
+// In strict mode, Code accepts only the mneumonics in the official form.
+//
+// The shift instructions in the extended instruction set, such as D<< and M>>,
+// are accepted only if the extended instruction set is enabled.
 type Code struct {
+	strict   bool
+	extended bool
+}
+
+// SetStrict sets whether c accepts only the mneumonics in the official form.
+func (c *Code) SetStrict(strict bool) {
+	c.strict = strict
+}
+
+// SetExtended sets whether c accepts the shift instructions in the extended instruction set.
+func (c *Code) SetExtended(extended bool) {
+	c.extended = extended
+}
+
+// IsExtended reports whether mneum is a comp mneumonic in the extended instruction set,
+// whether or not it is enabled.
+func (c *Code) IsExtended(mneum string) bool {
+	return extCompInstSet.isValid(removeSpaces(mneum))
+}
+
+// NormalizeDest returns the official form of the dest mneumonic.
+// If mneum is invalid, ok is false.
+func (c *Code) NormalizeDest(mneum string) (m string, ok bool) {
+	if destInstSet.isValid(mneum) {
+		return mneum, true
+	}
+	if c.strict {
+		return "", false
+	}
+
+	// reorder the registers as A, M and D
+	mneum = removeSpaces(mneum)
+	var buf strings.Builder
+	for _, r := range "AMD" {
+		if strings.ContainsRune(mneum, r) {
+			buf.WriteRune(r)
+		}
+	}
+	if m = buf.String(); len(m) != len(mneum) {
+		// unknown or duplicate register
+		return "", false
+	}
+	return m, destInstSet.isValid(m)
+}
+
+// NormalizeComp returns the official form of the comp mneumonic.
+// If mneum is invalid, ok is false.
+func (c *Code) NormalizeComp(mneum string) (m string, ok bool) {
+	if compInstSet.isValid(mneum) || c.extended && extCompInstSet.isValid(mneum) {
+		return mneum, true
+	}
+	if c.strict {
+		return "", false
+	}
+
+	m = removeSpaces(mneum)
+	if compInstSet.isValid(m) || c.extended && extCompInstSet.isValid(m) {
+		return m, true
+	}
+	// swap the operands of a commutative operator
+	if i := strings.IndexAny(m, "+&|"); i > 0 {
+		m = m[i+1:] + m[i:i+1] + m[:i]
+		return m, compInstSet.isValid(m)
+	}
+	return "", false
+}
+
+// NormalizeJump returns the official form of the jump mneumonic.
+// If mneum is invalid, ok is false.
+func (c *Code) NormalizeJump(mneum string) (m string, ok bool) {
+	if jumpInstSet.isValid(mneum) {
+		return mneum, true
+	}
+	if c.strict {
+		return "", false
+	}
+
+	m = removeSpaces(mneum)
+	return m, jumpInstSet.isValid(m)
+}
+
+// removeSpaces removes all the white spaces in s.
+func removeSpaces(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
 }
 
 // Dest returns 3 bit binary opcode corresponding to the dest mneumonic.
 func (c *Code) Dest(mneum string) (byte, error) {
-	if !destInstSet.isValid(mneum) {
+	m, ok := c.NormalizeDest(mneum)
+	if !ok {
 		return 0, fmt.Errorf("invalid dest mneumonic: %s", mneum)
 	}
-	return destInstSet[mneum], nil
+	return destInstSet[m], nil
+}
+
+// DestMneum returns the dest mneumonic corresponding to 3 bit binary opcode b.
+func (c *Code) DestMneum(b byte) (string, error) {
+	m, found := destInstSet.mneum(b)
+	if !found {
+		return "", fmt.Errorf("invalid dest opcode: %03b", b)
+	}
+	return m, nil
 }
 
 // IsValidDest reports whether mneum is a valid dest mneumonic.
 func (c *Code) IsValidDest(mneum string) bool {
-	return destInstSet.isValid(mneum)
+	_, ok := c.NormalizeDest(mneum)
+	return ok
 }
 
 // Comp returns 7 bit binary opcode corresponding to the comp mneumonic.
 func (c *Code) Comp(mneum string) (byte, error) {
-	if !compInstSet.isValid(mneum) {
+	m, ok := c.NormalizeComp(mneum)
+	if !ok {
 		return 0, fmt.Errorf("invalid comp mneumonic: %s", mneum)
 	}
-	return compInstSet[mneum], nil
+	if b, found := extCompInstSet[m]; found {
+		return b, nil
+	}
+	return compInstSet[m], nil
+}
+
+// CompMneum returns the comp mneumonic corresponding to 7 bit binary opcode b.
+func (c *Code) CompMneum(b byte) (string, error) {
+	m, found := compInstSet.mneum(b)
+	if !found {
+		return "", fmt.Errorf("invalid comp opcode: %07b", b)
+	}
+	return m, nil
+}
+
+// ExtCompMneum returns the comp mneumonic in the extended instruction set corresponding to
+// 7 bit binary opcode b, which is used with PrefixExt.
+func (c *Code) ExtCompMneum(b byte) (string, error) {
+	m, found := extCompInstSet.mneum(b)
+	if !found {
+		return "", fmt.Errorf("invalid extended comp opcode: %07b", b)
+	}
+	return m, nil
 }
 
 // IsValidComp reports whether mneum is a valid comp mneumonic.
 func (c *Code) IsValidComp(mneum string) bool {
-	return compInstSet.isValid(mneum)
+	_, ok := c.NormalizeComp(mneum)
+	return ok
 }
 
 // Jump returns 3 bit binary code corresponding to the jump mneumonic.
 func (c *Code) Jump(mneum string) (byte, error) {
-	if !jumpInstSet.isValid(mneum) {
+	m, ok := c.NormalizeJump(mneum)
+	if !ok {
 		return 0, fmt.Errorf("invalid jump mneumonic: %s", mneum)
 	}
-	return jumpInstSet[mneum], nil
+	return jumpInstSet[m], nil
+}
+
+// JumpMneum returns the jump mneumonic corresponding to 3 bit binary opcode b.
+func (c *Code) JumpMneum(b byte) (string, error) {
+	m, found := jumpInstSet.mneum(b)
+	if !found {
+		return "", fmt.Errorf("invalid jump opcode: %03b", b)
+	}
+	return m, nil
 }
 
 // IsValidJump reports whether mneum is a valid jump mneumonic.
 func (c *Code) IsValidJump(mneum string) bool {
-	return jumpInstSet.isValid(mneum)
+	_, ok := c.NormalizeJump(mneum)
+	return ok
 }
@@ -162,3 +162,121 @@ func TestJumpError(t *testing.T) {
 		}
 	}
 }
+
+func TestMneum(t *testing.T) {
+	var c Code
+	for m, b := range destInstSet {
+		got, err := c.DestMneum(b)
+		if err != nil || got != m {
+			t.Errorf("dest opcode %03b: got = %q, %v; want = %q", b, got, err, m)
+		}
+	}
+	for m, b := range compInstSet {
+		got, err := c.CompMneum(b)
+		if err != nil || got != m {
+			t.Errorf("comp opcode %07b: got = %q, %v; want = %q", b, got, err, m)
+		}
+	}
+	for m, b := range jumpInstSet {
+		got, err := c.JumpMneum(b)
+		if err != nil || got != m {
+			t.Errorf("jump opcode %03b: got = %q, %v; want = %q", b, got, err, m)
+		}
+	}
+}
+
+func TestMneumError(t *testing.T) {
+	var c Code
+	for _, b := range []byte{0x1, 0x7F, 0x4C} {
+		if m, err := c.CompMneum(b); err == nil {
+			t.Errorf("comp opcode %07b should be invalid, but got %q", b, m)
+		}
+	}
+	if m, err := c.DestMneum(0x8); err == nil {
+		t.Errorf("dest opcode 1000 should be invalid, but got %q", m)
+	}
+	if m, err := c.JumpMneum(0x8); err == nil {
+		t.Errorf("jump opcode 1000 should be invalid, but got %q", m)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	normalizeTests := []struct {
+		normalize func(c *Code, mneum string) (string, bool)
+		mneum     string
+		want      string // "" if invalid in relaxed mode
+		strict    bool   // whether valid in strict mode
+	}{
+		{(*Code).NormalizeDest, "AMD", "AMD", true},
+		{(*Code).NormalizeDest, "MA", "AM", false},
+		{(*Code).NormalizeDest, "DM", "MD", false},
+		{(*Code).NormalizeDest, "D A M", "AMD", false},
+		{(*Code).NormalizeDest, "MM", "", false},
+		{(*Code).NormalizeDest, "MX", "", false},
+		{(*Code).NormalizeComp, "D+M", "D+M", true},
+		{(*Code).NormalizeComp, "M+D", "D+M", false},
+		{(*Code).NormalizeComp, "D + M", "D+M", false},
+		{(*Code).NormalizeComp, "A&D", "D&A", false},
+		{(*Code).NormalizeComp, "M|D", "D|M", false},
+		{(*Code).NormalizeComp, "1+D", "D+1", false},
+		{(*Code).NormalizeComp, " - 1", "-1", false},
+		{(*Code).NormalizeComp, "D-A", "D-A", true},
+		{(*Code).NormalizeComp, "A-D+1", "", false},
+		{(*Code).NormalizeComp, "1-D", "", false},
+		{(*Code).NormalizeJump, "JMP", "JMP", true},
+		{(*Code).NormalizeJump, " JMP", "JMP", false},
+		{(*Code).NormalizeJump, "jmp", "", false},
+	}
+
+	var relaxed, strict Code
+	strict.SetStrict(true)
+	for _, tt := range normalizeTests {
+		got, ok := tt.normalize(&relaxed, tt.mneum)
+		if ok != (tt.want != "") || got != tt.want && ok {
+			t.Errorf("%q: got = (%q, %v); want = %q", tt.mneum, got, ok, tt.want)
+		}
+		if _, ok := tt.normalize(&strict, tt.mneum); ok != tt.strict {
+			t.Errorf("%q in strict mode: got = %v; want = %v", tt.mneum, ok, tt.strict)
+		}
+	}
+}
+
+func TestExtended(t *testing.T) {
+	extendedTests := []struct {
+		mneum string
+		want  byte
+	}{
+		{"A<<", 0x20},
+		{"D<<", 0x30},
+		{"M<<", 0x60},
+		{"A>>", 0x0},
+		{"D>>", 0x10},
+		{"M>>", 0x40},
+		{"D <<", 0x30},
+	}
+
+	var c, ext Code
+	ext.SetExtended(true)
+	for _, tt := range extendedTests {
+		if !c.IsExtended(tt.mneum) {
+			t.Errorf("%q should be an extended mneumonic", tt.mneum)
+		}
+		if _, err := c.Comp(tt.mneum); err == nil {
+			t.Errorf("%q should be invalid without the extended instruction set", tt.mneum)
+		}
+		got, err := ext.Comp(tt.mneum)
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got = %07b, %v; want = %07b", tt.mneum, got, err, tt.want)
+		}
+		if m, err := ext.ExtCompMneum(tt.want); err != nil || m != removeSpaces(tt.mneum) {
+			t.Errorf("extended comp opcode %07b: got = %q, %v; want = %q", tt.want, m, err, tt.mneum)
+		}
+	}
+
+	if c.IsExtended("D+1") {
+		t.Errorf("D+1 should not be an extended mneumonic")
+	}
+	if m, err := ext.ExtCompMneum(0x7F); err == nil {
+		t.Errorf("extended comp opcode 1111111 should be invalid, but got %q", m)
+	}
+}
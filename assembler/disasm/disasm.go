@@ -0,0 +1,218 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/skatsuta/nand2tetris/assembler/code"
+	"github.com/skatsuta/nand2tetris/assembler/parser"
+)
+
+const (
+	bitLen = 16
+
+	// prefixCCmd is the 3 bit prefix of a C instruction.
+	prefixCCmd = code.PrefixC
+	// prefixExt is the 3 bit prefix of an instruction in the extended instruction set.
+	prefixExt = code.PrefixExt
+)
+
+// word is a 16 bit word read from a line of input.
+type word struct {
+	line  int
+	text  string
+	value uint16
+	valid bool
+}
+
+// Disasm is a Hack disassembler that converts Hack binary code to assembly code.
+type Disasm struct {
+	file     string
+	labels   bool
+	extended bool
+	in       *bufio.Scanner
+	c        *code.Code
+}
+
+// New creates a new Disasm object that converts `in` to a Hack assembly code.
+func New(in io.Reader) *Disasm {
+	return &Disasm{
+		in: bufio.NewScanner(in),
+		c:  &code.Code{},
+	}
+}
+
+// SetFileName sets the name of the source file, which is used in diagnostics.
+func (d *Disasm) SetFileName(name string) {
+	d.file = name
+}
+
+// SetLabels sets whether d synthesizes labels for jump targets.
+// Each label is named after its ROM address, e.g. (L12) for the address 12,
+// so the output is assembled into the same binary code as the input.
+func (d *Disasm) SetLabels(labels bool) {
+	d.labels = labels
+}
+
+// SetExtended sets whether d decodes the shift instructions in the extended instruction set.
+func (d *Disasm) SetExtended(extended bool) {
+	d.extended = extended
+}
+
+// Run converts a Hack binary code that `d` holds to a Hack assembly code
+// and write it into out.
+//
+// A word that is not a valid Hack instruction is written out as a comment,
+// and Run returns all of them as a parser.ErrorList after writing the entire output.
+func (d *Disasm) Run(out io.Writer) error {
+	words, err := d.read()
+	if err != nil {
+		return err
+	}
+
+	var targets map[int]bool
+	if d.labels {
+		targets = d.jumpTargets(words)
+	}
+
+	var errs parser.ErrorList
+	w := bufio.NewWriter(out)
+	for addr, wd := range words {
+		if targets[addr] {
+			fmt.Fprintf(w, "(%s)\n", label(addr))
+		}
+
+		var inst string
+		if wd.valid {
+			inst, err = d.Inst(wd.value)
+		} else {
+			err = fmt.Errorf("invalid binary word: %q", wd.text)
+		}
+		if err != nil {
+			errs = append(errs, &parser.Error{
+				Pos:    parser.Pos{File: d.file, Line: wd.line, Column: 1},
+				Token:  wd.text,
+				Source: wd.text,
+				Msg:    err.Error(),
+			})
+			fmt.Fprintf(w, "// %s\n", err.Error())
+			continue
+		}
+
+		// replace the jump target address with its label
+		if targets[int(wd.value)] && d.isJump(words, addr) {
+			inst = "@" + label(int(wd.value))
+		}
+		fmt.Fprintln(w, inst)
+	}
+
+	// put a label at the end of the program if it is a jump target
+	if targets[len(words)] {
+		fmt.Fprintf(w, "(%s)\n", label(len(words)))
+	}
+
+	if e := w.Flush(); e != nil {
+		return fmt.Errorf("failed to write output: %s", e.Error())
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Inst returns an assembly instruction corresponding to the binary word i.
+// If i is not a valid Hack instruction, it returns an error.
+func (d *Disasm) Inst(i uint16) (string, error) {
+	// A instruction: 0vvvvvvvvvvvvvvv
+	if i>>(bitLen-1) == 0 {
+		return "@" + strconv.Itoa(int(i)), nil
+	}
+
+	// C instruction: 111 0000000(comp) 000(dest) 000(jump)
+	// extended instruction: 101 0000000(comp) 000(dest) 000(jump)
+	compMneum := d.c.CompMneum
+	switch i >> (bitLen - 3) {
+	case prefixCCmd:
+	case prefixExt:
+		if !d.extended {
+			return "", fmt.Errorf("invalid instruction: %0"+strconv.Itoa(bitLen)+"b (extended instructions are enabled by -ext option)", i)
+		}
+		compMneum = d.c.ExtCompMneum
+	default:
+		return "", fmt.Errorf("invalid instruction: %0"+strconv.Itoa(bitLen)+"b", i)
+	}
+	comp, err := compMneum(byte(i >> 6 & 0x7F))
+	if err != nil {
+		return "", fmt.Errorf("invalid instruction: %0"+strconv.Itoa(bitLen)+"b: %s", i, err.Error())
+	}
+	dest, _ := d.c.DestMneum(byte(i >> 3 & 0x7))
+	jump, _ := d.c.JumpMneum(byte(i & 0x7))
+
+	inst := comp
+	if dest != "" {
+		inst = dest + "=" + inst
+	}
+	if jump != "" {
+		inst += ";" + jump
+	}
+	return inst, nil
+}
+
+// read reads all the words from the input, skipping empty lines.
+func (d *Disasm) read() ([]word, error) {
+	var (
+		words  []word
+		lineno int
+	)
+	for d.in.Scan() {
+		lineno++
+		text := strings.TrimSpace(d.in.Text())
+		if text == "" {
+			continue
+		}
+
+		v, err := strconv.ParseUint(text, 2, bitLen)
+		words = append(words, word{
+			line:  lineno,
+			text:  text,
+			value: uint16(v),
+			valid: err == nil && len(text) == bitLen,
+		})
+	}
+	if e := d.in.Err(); e != nil {
+		return nil, fmt.Errorf("failed to read input: %s", e.Error())
+	}
+	return words, nil
+}
+
+// jumpTargets returns a set of ROM addresses that are loaded into A register
+// right before jump instructions. Addresses beyond the end of the program are excluded.
+func (d *Disasm) jumpTargets(words []word) map[int]bool {
+	targets := make(map[int]bool)
+	for addr, wd := range words {
+		if d.isJump(words, addr) && int(wd.value) <= len(words) {
+			targets[int(wd.value)] = true
+		}
+	}
+	return targets
+}
+
+// isJump reports whether words[addr] is an A instruction followed by a jump instruction,
+// which can be a shift instruction if d is extended.
+func (d *Disasm) isJump(words []word, addr int) bool {
+	if addr+1 >= len(words) {
+		return false
+	}
+	a, c := words[addr], words[addr+1]
+	prefix := c.value >> (bitLen - 3)
+	return a.valid && a.value>>(bitLen-1) == 0 &&
+		c.valid && (prefix == prefixCCmd || d.extended && prefix == prefixExt) && c.value&0x7 != 0
+}
+
+// label returns a label name of the ROM address addr.
+func label(addr int) string {
+	return "L" + strconv.Itoa(addr)
+}
@@ -0,0 +1,187 @@
+package disasm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/skatsuta/nand2tetris/assembler/asm"
+	"github.com/skatsuta/nand2tetris/assembler/parser"
+)
+
+func TestInst(t *testing.T) {
+	instTests := []struct {
+		word uint16
+		want string
+	}{
+		{0x0000, "@0"},
+		{0x7FFF, "@32767"},
+		{0xEC60, "A=!A"},
+		{0xF1C8, "M=M-D"},
+		{0xEFC7, "1;JMP"},
+		{0xEC85, "A-1;JNE"},
+		{0xE02E, "AM=D&A;JLE"},
+		{0xEA87, "0;JMP"},
+		{0xFC10, "D=M"},
+	}
+
+	d := New(strings.NewReader(""))
+	for _, tt := range instTests {
+		got, err := d.Inst(tt.word)
+		if err != nil {
+			t.Fatalf("Inst(%016b) failed: %s", tt.word, err.Error())
+		}
+		if got != tt.want {
+			t.Errorf("Inst(%016b): got = %q; want = %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestInstError(t *testing.T) {
+	d := New(strings.NewReader(""))
+	for _, w := range []uint16{0x8000, 0xA000, 0xC000, 0xE040, 0xFFC0} {
+		if got, err := d.Inst(w); err == nil {
+			t.Errorf("Inst(%016b) should fail, but got %q", w, got)
+		}
+	}
+}
+
+func TestInstExtended(t *testing.T) {
+	instExtendedTests := []struct {
+		word uint16
+		want string
+	}{
+		{0xAC10, "D=D<<"},
+		{0xB008, "M=M>>"},
+		{0xA825, "A=A<<;JNE"},
+	}
+
+	d := New(strings.NewReader(""))
+	d.SetExtended(true)
+	for _, tt := range instExtendedTests {
+		got, err := d.Inst(tt.word)
+		if err != nil {
+			t.Fatalf("Inst(%016b) failed: %s", tt.word, err.Error())
+		}
+		if got != tt.want {
+			t.Errorf("Inst(%016b): got = %q; want = %q", tt.word, got, tt.want)
+		}
+	}
+
+	if got, err := d.Inst(0xBFC0); err == nil {
+		t.Errorf("Inst(%016b) should fail, but got %q", 0xBFC0, got)
+	}
+}
+
+func TestRunExtendedLabels(t *testing.T) {
+	src := "0000000000000010\n1010110000000101\n1110101010000111\n"
+	want := "@L2\nD<<;JNE\n(L2)\n0;JMP\n"
+
+	d := New(strings.NewReader(src))
+	d.SetExtended(true)
+	d.SetLabels(true)
+
+	var out bytes.Buffer
+	if e := d.Run(&out); e != nil {
+		t.Fatalf("Run failed: %s", e.Error())
+	}
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRun(t *testing.T) {
+	src := "0000000000000100\n1110001100000001\n0000000000000010\n\n1110101010000111\n0000000000000100\n1110101010000111\n"
+
+	runTests := []struct {
+		labels bool
+		want   string
+	}{
+		{false, "@4\nD;JGT\n@2\n0;JMP\n@4\n0;JMP\n"},
+		{true, "@L4\nD;JGT\n(L2)\n@L2\n0;JMP\n(L4)\n@L4\n0;JMP\n"},
+	}
+
+	for _, tt := range runTests {
+		d := New(strings.NewReader(src))
+		d.SetLabels(tt.labels)
+
+		var out bytes.Buffer
+		if e := d.Run(&out); e != nil {
+			t.Fatalf("Run failed: %s", e.Error())
+		}
+		if out.String() != tt.want {
+			t.Errorf("labels %v:\ngot:\n%s\nwant:\n%s", tt.labels, out.String(), tt.want)
+		}
+	}
+}
+
+func TestRunError(t *testing.T) {
+	src := "0000000000000001\n1000000000000000\n12\n1110101010000111\n"
+
+	d := New(strings.NewReader(src))
+	d.SetFileName("a.hack")
+
+	var out bytes.Buffer
+	err := d.Run(&out)
+	list, ok := err.(parser.ErrorList)
+	if !ok {
+		t.Fatalf("got %#v; want parser.ErrorList", err)
+	}
+
+	want := []string{
+		"a.hack:2:1: invalid instruction: 1000000000000000",
+		`a.hack:3:1: invalid binary word: "12"`,
+	}
+	if len(list) != len(want) {
+		t.Fatalf("the number of errors should be %d, but got %d: %v", len(want), len(list), list)
+	}
+	for i, e := range list {
+		if e.Error() != want[i] {
+			t.Errorf("error %d: got %q; want %q", i, e.Error(), want[i])
+		}
+	}
+
+	wantOut := "@1\n// invalid instruction: 1000000000000000\n// invalid binary word: \"12\"\n0;JMP\n"
+	if out.String() != wantOut {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), wantOut)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	files := []string{
+		"../../projects/06/add/Add.hack",
+		"../../projects/06/max/Max.hack",
+		"../../projects/06/rect/Rect.hack",
+		"../../projects/06/pong/Pong.hack",
+	}
+
+	for _, file := range files {
+		want, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("failed to read %s: %s", file, err.Error())
+		}
+
+		for _, labels := range []bool{false, true} {
+			d := New(bytes.NewReader(want))
+			d.SetLabels(labels)
+			var src bytes.Buffer
+			if e := d.Run(&src); e != nil {
+				t.Fatalf("%s: Run failed: %s", file, e.Error())
+			}
+
+			asmblr, err := asm.New(&src)
+			if err != nil {
+				t.Fatalf("asm.New failed: %s", err.Error())
+			}
+			var got bytes.Buffer
+			if e := asmblr.Run(&got); e != nil {
+				t.Fatalf("%s: reassembling failed: %s", file, e.Error())
+			}
+
+			if got.String() != string(want) {
+				t.Errorf("%s (labels %v): reassembled code differs from the original", file, labels)
+			}
+		}
+	}
+}
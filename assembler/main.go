@@ -1,52 +1,94 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/skatsuta/nand2tetris/assembler/asm"
+	"github.com/skatsuta/nand2tetris/assembler/disasm"
+	"github.com/skatsuta/nand2tetris/assembler/parser"
 )
 
 const (
-	// extension name of binary file
-	binExt = "hack"
+	// extension name of disassembled file
+	disasmExt = "dis.asm"
+	// extension name of listing file
+	listExt = "lst"
+	// extension name of symbol table file
+	symExt = "sym"
+	// extension name of symbol table file in JSON
+	symJSONExt = "sym.json"
+	// extension name of relocatable object file
+	objExt = "obj"
 )
 
-// pre-defined symbols
-var preDefSymb = map[string]uintptr{
-	"SP":     0x0,
-	"LCL":    0x1,
-	"ARG":    0x2,
-	"THIS":   0x3,
-	"THAT":   0x4,
-	"R0":     0x0,
-	"R1":     0x1,
-	"R2":     0x2,
-	"R3":     0x3,
-	"R4":     0x4,
-	"R5":     0x5,
-	"R6":     0x6,
-	"R7":     0x7,
-	"R8":     0x8,
-	"R9":     0x9,
-	"R10":    0xA,
-	"R11":    0xB,
-	"R12":    0xC,
-	"R13":    0xD,
-	"R14":    0xE,
-	"R15":    0xF,
-	"SCREEN": 0x4000,
-	"KBD":    0x6000,
+var (
+	// maxErrs is the maximum number of diagnostics reported per file.
+	maxErrs = flag.Int("maxerrs", asm.DefaultMaxErrors, "maximum number of errors reported per file (0 means unlimited)")
+	// disasmMode makes the program work as a disassembler.
+	disasmMode = flag.Bool("d", false, "disassemble .hack files into ."+disasmExt+" files")
+	// format is a name of the output format.
+	format = flag.String("f", "hack", "output `format`: "+strings.Join(asm.FormatNames(), ", "))
+	// listing makes the assembler write a listing file.
+	listing = flag.Bool("l", false, "write a listing file ."+listExt+" alongside the machine code")
+	// symFormat is a format of the symbol table file.
+	symFormat = flag.String("sym", "", "write the symbol table in `format` \"text\" (."+symExt+") or \"json\" (."+symJSONExt+")")
+	// incdirs is a list of directories to search for included files.
+	incdirs dirList
+	// object makes the assembler write a relocatable object file.
+	object = flag.Bool("c", false, "write a relocatable object file ."+objExt+" to be linked by hacklink")
+	// stats makes the assembler print a usage summary of ROM and RAM.
+	stats = flag.Bool("stats", false, "print a summary of ROM words and variable RAM used")
+	// strict makes the assembler accept only C instructions in the official form.
+	strict = flag.Bool("strict", false, "accept only C instructions in the official form, e.g. for grading")
+	// extended enables the shift instructions in the extended instruction set.
+	extended = flag.Bool("ext", false, "enable the shift instructions (e.g. D=D<<) in the extended instruction set")
+	// labels makes the disassembler synthesize labels for jump targets.
+	labels = flag.Bool("labels", false, "synthesize labels for jump targets in disassembly (with -d)")
+)
+
+func init() {
+	flag.Var(&incdirs, "I", "add `dir` to the directories to search for included files (repeatable)")
+}
+
+// dirList is a list of directories given by repeated flags. It implements flag.Value.
+type dirList []string
+
+func (l *dirList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *dirList) Set(dir string) error {
+	*l = append(*l, dir)
+	return nil
 }
 
 func main() {
 	flag.Parse()
 	args := flag.Args()
 
+	switch *symFormat {
+	case "", "text", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown symbol table format: %s\n", *symFormat)
+		os.Exit(2)
+	}
+	if _, found := asm.LookupFormat(*format); !found {
+		fmt.Fprintf(os.Stderr, "unknown output format: %s\n", *format)
+		os.Exit(2)
+	}
+
+	conv := convert
+	if *disasmMode {
+		conv = disassemble
+	}
+
 	msg := make(chan string, len(args))
 	var wg sync.WaitGroup
 
@@ -55,7 +97,7 @@ func main() {
 	for _, path := range args {
 		go func(path string) {
 			defer wg.Done()
-			msg <- convert(path)
+			msg <- conv(path)
 		}(path)
 	}
 
@@ -81,28 +123,147 @@ func convert(path string) string {
 	}
 	defer close0(in)
 
-	// create destination file
-	outName := outPath(path, binExt)
-	out, err := os.Create(outName)
+	// create a new Asm object
+	asmblr, err := asm.New(in)
 	if err != nil {
 		return err.Error()
 	}
-	defer close0(out)
 
-	// create a new Asm object
-	asmblr, err := asm.New(in)
+	// report diagnostics in the form "file:line:col: message"
+	asmblr.SetFileName(path)
+	asmblr.SetMaxErrors(*maxErrs)
+	asmblr.SetIncludePaths(incdirs)
+	asmblr.SetStrict(*strict)
+	asmblr.SetExtended(*extended)
+
+	// set output format
+	f, _ := asm.LookupFormat(*format)
+	asmblr.SetFormat(f)
+
+	// write an object file instead
+	ext := f.Ext()
+	if *object {
+		asmblr.SetRelocatable(true)
+		ext = objExt
+	}
+
+	// add pre-defined symbols
+	asmblr.DefineSymbols(asm.PredefinedSymbols)
+
+	// convert source file to binary code
+	var buf bytes.Buffer
+	runErr := asmblr.Run(&buf)
+
+	// report warnings whether or not the conversion succeeds
+	var warns string
+	if w := asmblr.Warnings(); len(w) > 0 {
+		warns = errMsg(w) + "\n"
+	}
+	if runErr != nil {
+		return warns + errMsg(runErr)
+	}
+
+	// create destination files only if the conversion succeeds
+	outName := outPath(path, ext)
+	if e := writeFile(outName, writeBuf(&buf)); e != nil {
+		return e.Error()
+	}
+	if *listing {
+		if e := writeFile(outPath(path, listExt), asmblr.WriteListing); e != nil {
+			return e.Error()
+		}
+	}
+	switch *symFormat {
+	case "":
+	case "text":
+		if e := writeFile(outPath(path, symExt), asmblr.SymbolTable().WriteSym); e != nil {
+			return e.Error()
+		}
+	case "json":
+		if e := writeFile(outPath(path, symJSONExt), asmblr.SymbolTable().WriteJSON); e != nil {
+			return e.Error()
+		}
+	}
+	msg := fmt.Sprintf("Successfully converted %s to %s", path, outName)
+	if *stats {
+		msg += fmt.Sprintf("\n%s: %s", path, asmblr.Usage())
+	}
+	return warns + msg
+}
+
+// disassemble converts Hack machine code in path to assembly code and write it to a file.
+// It returns a result message if successful, otherwise an error message.
+// Invalid words are written out as comments and reported as errors.
+func disassemble(path string) string {
+	// open source file
+	in, err := os.Open(path)
 	if err != nil {
 		return err.Error()
 	}
+	defer close0(in)
 
-	// add pre-defined symbols
-	asmblr.DefineSymbols(preDefSymb)
+	d := disasm.New(in)
+	d.SetFileName(path)
+	d.SetLabels(*labels)
+	d.SetExtended(*extended)
+
+	var buf bytes.Buffer
+	runErr := d.Run(&buf)
+	if _, ok := runErr.(parser.ErrorList); runErr != nil && !ok {
+		return runErr.Error()
+	}
 
-	// convert source file to binary file
-	if e := asmblr.Run(out); e != nil {
+	// create destination file
+	outName := outPath(path, disasmExt)
+	if e := writeFile(outName, writeBuf(&buf)); e != nil {
 		return e.Error()
 	}
-	return fmt.Sprintf("Successfully converted %s to %s", path, outName)
+	if runErr != nil {
+		return errMsg(runErr)
+	}
+	return fmt.Sprintf("Successfully disassembled %s to %s", path, outName)
+}
+
+// writeFile creates a file named name and writes into it by write.
+func writeFile(name string, write func(io.Writer) error) error {
+	out, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer close0(out)
+
+	return write(out)
+}
+
+// writeBuf returns a function that writes the content of buf.
+func writeBuf(buf *bytes.Buffer) func(io.Writer) error {
+	return func(w io.Writer) error {
+		_, e := buf.WriteTo(w)
+		return e
+	}
+}
+
+// errMsg returns an error message of err. If err is a list of diagnostics,
+// it returns all of them, each followed by the offending source line and notes.
+func errMsg(err error) string {
+	list, ok := err.(parser.ErrorList)
+	if !ok {
+		return err.Error()
+	}
+
+	msgs := make([]string, len(list))
+	for i, e := range list {
+		msgs[i] = fmt.Sprintf("%s: %s", e.Pos, e.Message())
+		// show the offending line
+		if snip := e.Snippet(); snip != "" {
+			msgs[i] += "\n" + snip
+		}
+		// show where the line comes from, e.g. macro call sites
+		for _, n := range e.Notes {
+			msgs[i] += fmt.Sprintf("\n%s: %s", n.Pos, n.Msg)
+		}
+	}
+	return strings.Join(msgs, "\n")
 }
 
 // outPath returns a new output file name path with the given new extension name.
@@ -0,0 +1,61 @@
+package obj
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// RelocKind represents a kind of a relocation.
+type RelocKind string
+
+// A list of relocation kinds.
+const (
+	// RelocROM means the word is a ROM address relative to the beginning of the module,
+	// to which the linker adds the address the module is placed at.
+	RelocROM RelocKind = "rom"
+	// RelocSymbol means the word is replaced by the address of a symbol resolved by the linker,
+	// which is either a label imported from another module or a variable.
+	// The assembler writes 0 into the word.
+	RelocSymbol RelocKind = "symbol"
+)
+
+// Reloc is a relocation entry, which tells the linker how to fix up a word.
+type Reloc struct {
+	Index  int       `json:"index"` // index of the word to fix up
+	Kind   RelocKind `json:"kind"`
+	Symbol string    `json:"symbol,omitempty"` // symbol name for RelocSymbol
+}
+
+// Object is a relocatable object module of Hack machine code.
+type Object struct {
+	Name    string            `json:"name"`              // name of the source file
+	Words   []uint16          `json:"words"`             // machine code
+	Exports map[string]uint16 `json:"exports,omitempty"` // labels and their ROM addresses relative to the module
+	Imports []string          `json:"imports,omitempty"` // labels defined in other modules
+	Relocs  []Reloc           `json:"relocs,omitempty"`
+}
+
+// Read reads an object module from r.
+func Read(r io.Reader) (*Object, error) {
+	var o Object
+	if e := json.NewDecoder(r).Decode(&o); e != nil {
+		return nil, fmt.Errorf("invalid object file: %s", e.Error())
+	}
+	for _, rel := range o.Relocs {
+		if rel.Index < 0 || rel.Index >= len(o.Words) {
+			return nil, fmt.Errorf("invalid object file: relocation index %d out of range", rel.Index)
+		}
+		if rel.Kind != RelocROM && rel.Kind != RelocSymbol {
+			return nil, fmt.Errorf("invalid object file: unknown relocation kind %q", rel.Kind)
+		}
+	}
+	return &o, nil
+}
+
+// Write writes o into w.
+func (o *Object) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(o)
+}
@@ -0,0 +1,51 @@
+package obj
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	want := &Object{
+		Name:    "main.asm",
+		Words:   []uint16{0, 0xEA87, 5},
+		Exports: map[string]uint16{"MAIN": 0},
+		Imports: []string{"MULT"},
+		Relocs: []Reloc{
+			{Index: 0, Kind: RelocSymbol, Symbol: "MULT"},
+			{Index: 2, Kind: RelocROM},
+		},
+	}
+
+	var buf bytes.Buffer
+	if e := want.Write(&buf); e != nil {
+		t.Fatalf("Write failed: %s", e.Error())
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read failed: %s", err.Error())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:  %+v\nwant: %+v", got, want)
+	}
+}
+
+func TestReadError(t *testing.T) {
+	readErrorTests := []struct {
+		src  string
+		want string
+	}{
+		{`{"words": [0], "relocs": [{"index": 1, "kind": "rom"}]}`, "invalid object file: relocation index 1 out of range"},
+		{`{"words": [0], "relocs": [{"index": 0, "kind": "abs"}]}`, `invalid object file: unknown relocation kind "abs"`},
+		{`{"words": [65536]}`, "invalid object file: "},
+	}
+
+	for _, tt := range readErrorTests {
+		_, err := Read(strings.NewReader(tt.src))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("%s: got %v; want %s", tt.src, err, tt.want)
+		}
+	}
+}
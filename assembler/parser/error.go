@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pos is a position in a source file.
+type Pos struct {
+	File   string // file name, if any
+	Line   int    // line number, starting at 1
+	Column int    // column number, starting at 1 (byte count)
+}
+
+// String returns a string in one of the forms "file:line:column" or "line:column".
+func (pos Pos) String() string {
+	s := fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	if pos.File != "" {
+		s = pos.File + ":" + s
+	}
+	return s
+}
+
+// Site is a source line of a command, about which diagnostics are made.
+type Site struct {
+	pos   Pos    // position of the line
+	raw   string // source line
+	line  string // command trimmed white spaces
+	notes []Note // where the line comes from
+	// origin is the position of the line in a source file, which is the call site of
+	// the outermost macro if the line is in a macro expansion
+	origin Pos
+}
+
+// Pos returns the position of the command.
+func (s Site) Pos() Pos {
+	return s.posAt(0)
+}
+
+// Origin returns the file and the line number of the line in a source file from which
+// the command comes. For a command in a macro expansion, it is the call site of the macro.
+func (s Site) Origin() Pos {
+	return Pos{File: s.origin.File, Line: s.origin.Line}
+}
+
+// Source returns the source line of the command.
+func (s Site) Source() string {
+	return s.raw
+}
+
+// Errorf returns a diagnostic about tok in the command.
+// The column points at the first occurrence of tok in the command,
+// or at the beginning of the command if tok is not found.
+func (s Site) Errorf(tok string, format string, args ...interface{}) *Error {
+	off := strings.Index(s.line, tok)
+	if off < 0 {
+		off = 0
+	}
+	return s.errorAt(off, tok, format, args...)
+}
+
+// errorAt returns a diagnostic about tok which starts at offset off in the command.
+func (s Site) errorAt(off int, tok string, format string, args ...interface{}) *Error {
+	return &Error{
+		Pos:    s.posAt(off),
+		Token:  tok,
+		Source: s.raw,
+		Msg:    fmt.Sprintf(format, args...),
+		Notes:  s.notes,
+	}
+}
+
+// posAt returns the position of offset off in the command.
+func (s Site) posAt(off int) Pos {
+	indent := len(s.raw) - len(strings.TrimLeft(s.raw, " \t"))
+	return Pos{
+		File:   s.pos.File,
+		Line:   s.pos.Line,
+		Column: indent + off + 1,
+	}
+}
+
+// Note is a supplementary message attached to a position,
+// such as a call site of the macro in which an error is found.
+type Note struct {
+	Pos
+	Msg string
+}
+
+// Error is a diagnostic found in a source file.
+// It holds the position and the offending token as well as the message.
+type Error struct {
+	Pos
+	Token  string // offending token
+	Source string // source line which contains the token
+	Msg    string // error message
+	Notes  []Note // where the source line comes from, innermost first
+	// Warning reports whether the diagnostic is a warning, which does not stop the assembly.
+	Warning bool
+}
+
+// Error returns a string in the form "file:line:column: message".
+// Each note follows it in a new line in the form "\tfile:line:column: note".
+func (e *Error) Error() string {
+	s := fmt.Sprintf("%s: %s", e.Pos, e.Message())
+	for _, n := range e.Notes {
+		s += fmt.Sprintf("\n\t%s: %s", n.Pos, n.Msg)
+	}
+	return s
+}
+
+// Message returns the message of e, which is prefixed with "warning: " if e is a warning.
+func (e *Error) Message() string {
+	if e.Warning {
+		return "warning: " + e.Msg
+	}
+	return e.Msg
+}
+
+// Snippet returns the source line and a caret pointing at the column below it,
+// each of which is indented by a tab. If the source line is unknown, it returns "".
+func (e *Error) Snippet() string {
+	if e.Source == "" {
+		return ""
+	}
+
+	// keep tabs so that the caret is aligned with the source line
+	caret := []byte(e.Source)
+	if e.Column-1 < len(caret) {
+		caret = caret[:e.Column-1]
+	}
+	for i, c := range caret {
+		if c != '\t' {
+			caret[i] = ' '
+		}
+	}
+	return "\t" + e.Source + "\n\t" + string(caret) + "^"
+}
+
+// ErrorList is a list of diagnostics.
+type ErrorList []*Error
+
+// Error returns the first error message and the number of the rest.
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// include pushes the lines of the file named by arg onto the input.
+// arg is a file name optionally enclosed in double quotes.
+func (p *Parser) include(arg string) {
+	name := arg
+	if strings.HasPrefix(arg, `"`) {
+		if len(arg) < 2 || !strings.HasSuffix(arg, `"`) {
+			p.pending = p.Errorf(arg, "unterminated file name in %s: %s", dirInclude, arg)
+			return
+		}
+		name = arg[1 : len(arg)-1]
+	}
+	if name == "" {
+		p.pending = p.errorAt(0, dirInclude, "missing file name in %s", dirInclude)
+		return
+	}
+	if len(p.frames) >= maxMacroDepth {
+		p.pending = p.Errorf(arg, "%s nested too deeply", dirInclude)
+		return
+	}
+
+	path, err := p.findInclude(name)
+	if err != nil {
+		p.pending = p.Errorf(arg, "%s", err.Error())
+		return
+	}
+
+	// detect an include cycle
+	chain := p.includeChain()
+	for i, file := range chain {
+		if sameFile(file, path) {
+			cycle := append(chain[i:], path)
+			p.pending = p.Errorf(arg, "include cycle: %s", strings.Join(cycle, " -> "))
+			return
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		p.pending = p.Errorf(arg, "cannot read included file: %s", err.Error())
+		return
+	}
+
+	var lines []line
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		lines = append(lines, line{text: sc.Text(), pos: Pos{File: path, Line: n}})
+	}
+	if e := sc.Err(); e != nil {
+		p.pending = p.Errorf(arg, "cannot read included file %s: %s", path, e.Error())
+		return
+	}
+	p.frames = append(p.frames, &frame{
+		lines: lines,
+		file:  path,
+		note:  Note{Pos: p.posAt(0), Msg: "included from here"},
+	})
+}
+
+// findInclude returns the path of the included file name. A relative name is searched
+// in the directory of the including file first, and then in the include paths in order.
+func (p *Parser) findInclude(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		if !isFile(name) {
+			return "", fmt.Errorf("cannot find included file %s", name)
+		}
+		return name, nil
+	}
+
+	dirs := append([]string{filepath.Dir(p.pos.File)}, p.incdirs...)
+	for _, dir := range dirs {
+		if path := filepath.Join(dir, name); isFile(path) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find included file %s in %s", name, strings.Join(dirs, ", "))
+}
+
+// includeChain returns the paths of the input file and the files being included, outermost first.
+func (p *Parser) includeChain() []string {
+	var chain []string
+	if p.file != "" {
+		chain = append(chain, p.file)
+	}
+	for _, f := range p.frames {
+		if f.file != "" {
+			chain = append(chain, f.file)
+		}
+	}
+	return chain
+}
+
+// isFile reports whether path is an existing regular file.
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// sameFile reports whether paths p1 and p2 refer to the same file.
+func sameFile(p1, p2 string) bool {
+	info1, err1 := os.Stat(p1)
+	info2, err2 := os.Stat(p2)
+	if err1 != nil || err2 != nil {
+		return filepath.Clean(p1) == filepath.Clean(p2)
+	}
+	return os.SameFile(info1, info2)
+}
@@ -0,0 +1,172 @@
+package parser
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files into a new temporary directory and returns the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "parser")
+	if err != nil {
+		t.Fatalf("failed to create a temporary directory: %s", err.Error())
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if e := os.MkdirAll(filepath.Dir(path), 0755); e != nil {
+			t.Fatalf("failed to create a directory: %s", e.Error())
+		}
+		if e := ioutil.WriteFile(path, []byte(content), 0644); e != nil {
+			t.Fatalf("failed to write %s: %s", name, e.Error())
+		}
+	}
+	return dir
+}
+
+// parseFile parses the file path and returns the commands and the errors in it.
+func parseFile(t *testing.T, path string, incdirs ...string) ([]string, []*Error) {
+	src, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %s", path, err.Error())
+	}
+	defer src.Close()
+
+	p := NewParser(src)
+	p.SetFileName(path)
+	p.SetIncludePaths(incdirs)
+
+	var (
+		cmds []string
+		errs []*Error
+	)
+	for p.HasMoreCommands() {
+		if e := p.Advance(); e != nil {
+			errs = append(errs, e.(*Error))
+			continue
+		}
+		cmds = append(cmds, p.command.cmd)
+	}
+	return cmds, errs
+}
+
+func TestInclude(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.asm":      "@0\n.include \"lib/mult.asm\"\n.include wait.asm // from include path\n@1\n",
+		"lib/mult.asm":  "(MULT)\n  .include \"ret.asm\"\n",
+		"lib/ret.asm":   "@R15\nA=M\n0;JMP\n",
+		"inc/wait.asm":  ".macro WAIT\n(LOOP)\n@KBD\nD=M\n@LOOP\nD;JEQ\n.endm\n",
+		"other/ret.asm": "@WRONG\n",
+	})
+	defer os.RemoveAll(dir)
+
+	cmds, errs := parseFile(t, filepath.Join(dir, "main.asm"), filepath.Join(dir, "other"), filepath.Join(dir, "inc"))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	want := []string{"@0", "(MULT)", "@R15", "A=M", "0;JMP", "@1"}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Errorf("got: %q; want: %q", cmds, want)
+	}
+}
+
+func TestIncludeError(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.asm":     "@0\n.include \"b.asm\"\n",
+		"b.asm":     "@1\n.include \"a.asm\"\n",
+		"bad.asm":   "@0\n.include \"sub/c.asm\"\n",
+		"sub/c.asm": "@2\nD=D*A\n",
+		"none.asm":  ".include \"none.asm\"\n.include \"x\n.include\n",
+	})
+	defer os.RemoveAll(dir)
+
+	a, b, c := filepath.Join(dir, "a.asm"), filepath.Join(dir, "b.asm"), filepath.Join(dir, "sub", "c.asm")
+
+	_, errs := parseFile(t, a)
+	if len(errs) != 1 {
+		t.Fatalf("the number of errors should be 1, but got %d: %v", len(errs), errs)
+	}
+	want := b + ":2:10: include cycle: " + a + " -> " + b + " -> " + a + "\n\t" + a + ":2:1: included from here"
+	if errs[0].Error() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", errs[0].Error(), want)
+	}
+
+	_, errs = parseFile(t, filepath.Join(dir, "bad.asm"))
+	if len(errs) != 1 {
+		t.Fatalf("the number of errors should be 1, but got %d: %v", len(errs), errs)
+	}
+	want = c + ":2:3: invalid comp command: \"D*A\"\n\t" + filepath.Join(dir, "bad.asm") + ":2:1: included from here"
+	if errs[0].Error() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", errs[0].Error(), want)
+	}
+
+	// a file cannot include itself, either
+	_, errs = parseFile(t, filepath.Join(dir, "none.asm"))
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Msg)
+	}
+	none := filepath.Join(dir, "none.asm")
+	wantMsgs := []string{
+		"include cycle: " + none + " -> " + none,
+		"unterminated file name in .include: \"x",
+		"missing file name in .include",
+	}
+	if !reflect.DeepEqual(got, wantMsgs) {
+		t.Errorf("got: %q; want: %q", got, wantMsgs)
+	}
+}
+
+func TestIncludeUnclosedMacro(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.asm": ".include \"lib.asm\"\n@1\n",
+		"lib.asm":  ".macro F\n@0\n",
+	})
+	defer os.RemoveAll(dir)
+
+	main, lib := filepath.Join(dir, "main.asm"), filepath.Join(dir, "lib.asm")
+	cmds, errs := parseFile(t, main)
+	if len(errs) != 1 {
+		t.Fatalf("the number of errors should be 1, but got %d: %v", len(errs), errs)
+	}
+	want := lib + ":1:1: missing .endm for macro F\n\t" + main + ":1:1: included from here"
+	if errs[0].Error() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", errs[0].Error(), want)
+	}
+	// the lines after the include directive are not taken into the macro body
+	if want := []string{"@1"}; !reflect.DeepEqual(cmds, want) {
+		t.Errorf("got: %q; want: %q", cmds, want)
+	}
+}
+
+func TestIncludeLongLine(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.asm": ".include \"long.asm\"\n",
+		"long.asm": "@" + strings.Repeat("A", bufio.MaxScanTokenSize) + "\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, errs := parseFile(t, filepath.Join(dir, "main.asm"))
+	if len(errs) != 1 || !strings.Contains(errs[0].Msg, "cannot read included file") {
+		t.Errorf("got %v; want an error reading long.asm", errs)
+	}
+}
+
+func TestIncludeNotFound(t *testing.T) {
+	p := NewParser(strings.NewReader(`.include "no/such/file.asm"`))
+	p.SetIncludePaths([]string{"lib"})
+
+	if !p.HasMoreCommands() {
+		t.Fatal("HasMoreCommands should return true to report an error")
+	}
+	err := p.Advance()
+	want := `1:10: cannot find included file no/such/file.asm in ., lib`
+	if err == nil || err.Error() != want {
+		t.Errorf("got: %v; want: %s", err, want)
+	}
+}
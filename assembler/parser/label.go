@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/skatsuta/nand2tetris/assembler/symbtbl"
+)
+
+// prefixLocal is a prefix of a local label.
+const prefixLocal = '.'
+
+// label returns the full name of a label symb defined in the current command.
+//
+// A local label such as (.loop) belongs to the preceding global label, e.g. (MULT),
+// and its full name is MULT.loop. A global label starts a new scope of local labels
+// unless it is defined in a macro body, where labels are renamed to unique ones.
+// An anonymous label such as (1) neither starts a scope nor is renamed.
+func (p *Parser) label(symb string) (string, *Error) {
+	switch {
+	case symb[0] == prefixLocal:
+		return p.local(symb)
+	case symbtbl.IsAnonLabel(symb), p.inMacro():
+		return symb, nil
+	}
+	p.scope = symb
+	return symb, nil
+}
+
+// local returns the full name of a local label symb.
+func (p *Parser) local(symb string) (string, *Error) {
+	if p.scope == "" {
+		return "", p.Errorf(symb, "local label %s without a preceding label", symb)
+	}
+	return p.scope + symb, nil
+}
+
+// qualify replaces each local label in text, which is an operand of an A instruction,
+// with its full name. Character literals such as '.' are left as they are.
+func (p *Parser) qualify(text string) (string, *Error) {
+	if strings.IndexByte(text, prefixLocal) < 0 {
+		return text, nil
+	}
+
+	var buf strings.Builder
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == '\'' && i+2 < len(text) && text[i+2] == '\'':
+			buf.WriteString(text[i : i+3])
+			i += 3
+		case symbtbl.IsSymbolChar(c):
+			j := i
+			for j < len(text) && symbtbl.IsSymbolChar(text[j]) {
+				j++
+			}
+			name := text[i:j]
+			if name[0] == prefixLocal {
+				var err *Error
+				if name, err = p.local(name); err != nil {
+					return "", err
+				}
+			}
+			buf.WriteString(name)
+			i = j
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+	}
+	return buf.String(), nil
+}
+
+// inMacro reports whether the current command comes from a macro expansion.
+func (p *Parser) inMacro() bool {
+	return len(p.frames) > 0 && p.frames[len(p.frames)-1].file == ""
+}
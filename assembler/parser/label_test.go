@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLocalLabel(t *testing.T) {
+	src := `.macro WAIT
+(LOOP)
+	@LOOP
+	@.done
+.endm
+(MULT)
+(.loop)
+	WAIT
+	@.loop
+	@.loop+'.'
+(1)
+	@1b
+(DIV)
+(.loop)
+	@.loop
+`
+	want := []string{
+		"MULT", "MULT.loop", "WAIT$LOOP.1", "WAIT$LOOP.1", "MULT.done",
+		"MULT.loop", "MULT.loop+'.'", "1", "1b", "DIV", "DIV.loop", "DIV.loop",
+	}
+
+	p := NewParser(strings.NewReader(src))
+	var got []string
+	for p.HasMoreCommands() {
+		if e := p.Advance(); e != nil {
+			t.Fatalf("Advance failed: %s", e.Error())
+		}
+		got = append(got, p.Symbol())
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestLocalLabelError(t *testing.T) {
+	localLabelErrorTests := []struct {
+		src  string
+		want string
+	}{
+		{"(.loop)", "1:2: local label .loop without a preceding label"},
+		{"@.loop", "1:2: local label .loop without a preceding label"},
+		{"@1+.end", "1:4: local label .end without a preceding label"},
+		{"()", "1:1: missing label name"},
+	}
+
+	for _, tt := range localLabelErrorTests {
+		p := NewParser(strings.NewReader(tt.src))
+		if !p.HasMoreCommands() {
+			t.Fatalf("src %q: HasMoreCommands should return true", tt.src)
+		}
+		err := p.Advance()
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("src %q: got %v; want %s", tt.src, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/skatsuta/nand2tetris/assembler/symbtbl"
+)
+
+const (
+	// dirMacro is a directive which begins a macro definition.
+	dirMacro = ".macro"
+	// dirEndMacro is a directive which ends a macro definition.
+	dirEndMacro = ".endm"
+
+	// dirInclude is a directive which includes a file.
+	dirInclude = ".include"
+
+	// maxMacroDepth is the maximum depth of nested macro expansions and included files.
+	maxMacroDepth = 64
+)
+
+// line is a source line and its position.
+type line struct {
+	text string
+	pos  Pos
+}
+
+// macro is a macro definition.
+type macro struct {
+	name   string
+	params []string
+	body   []line
+	labels map[string]bool // labels defined in the body
+}
+
+// frame is a sequence of lines pushed onto the input, which is read before the rest of input.
+// It is either a macro expansion or an included file.
+type frame struct {
+	lines []line // body lines whose parameters and labels are substituted, or lines of a file
+	next  int    // index of the next line
+	file  string // path of the included file, or "" for a macro expansion
+	note  Note   // call site of the macro or position of the include directive
+}
+
+// preprocess handles the current line if it is a macro definition, a macro call or
+// an include directive, and reports whether the line is handled.
+// If an error is found, it is set to p.pending.
+//
+// A macro is defined as follows:
+//
+//	.macro NAME param1, param2, ...
+//	    body
+//	.endm
+//
+// and called by its name with the same number of arguments as the parameters:
+//
+//	NAME arg1, arg2, ...
+//
+// In each expansion, the parameters in the body are replaced with the arguments
+// and the labels defined in the body are renamed to unique ones.
+//
+// A file is included by
+//
+//	.include "file.asm"
+//
+// and its lines are read in place of the directive.
+func (p *Parser) preprocess() bool {
+	cmd := p.trimComment(p.line)
+	name := cmd
+	if i := strings.IndexFunc(cmd, unicode.IsSpace); i >= 0 {
+		name = cmd[:i]
+	}
+	rest := cmd[len(name):]
+
+	switch name {
+	case dirMacro:
+		p.defineMacro(rest)
+		return true
+	case dirEndMacro:
+		p.pending = p.errorAt(0, name, "%s without %s", dirEndMacro, dirMacro)
+		return true
+	case dirInclude:
+		p.include(strings.TrimSpace(rest))
+		return true
+	}
+
+	m, found := p.macros[name]
+	if !found {
+		return false
+	}
+	p.expand(m, rest)
+	return true
+}
+
+// defineMacro reads a macro definition whose parameters are params.
+// It consumes lines up to the end of the definition even if an error is found.
+func (p *Parser) defineMacro(params string) {
+	args := splitArgs(params)
+
+	var err *Error
+	switch {
+	case len(args) == 0:
+		err = p.errorAt(0, dirMacro, "missing macro name")
+	case !symbtbl.IsSymbol(args[0]):
+		err = p.Errorf(args[0], "invalid macro name: %s", args[0])
+	case p.reserved(args[0]):
+		err = p.Errorf(args[0], "macro name %s is a register, a mnemonic or a pre-defined symbol", args[0])
+	case p.macros[args[0]] != nil:
+		err = p.Errorf(args[0], "macro %s redefined", args[0])
+	default:
+		seen := make(map[string]bool)
+		for _, param := range args[1:] {
+			if !symbtbl.IsSymbol(param) || seen[param] {
+				// point at the last one, which is a duplicate
+				off := strings.LastIndex(p.line, param)
+				err = p.errorAt(off, param, "invalid or duplicate parameter %s in macro %s", param, args[0])
+				break
+			}
+			if p.reserved(param) {
+				off := strings.LastIndex(p.line, param)
+				err = p.errorAt(off, param, "parameter %s in macro %s is a register, a mnemonic or a pre-defined symbol", param, args[0])
+				break
+			}
+			seen[param] = true
+		}
+	}
+
+	m := &macro{labels: make(map[string]bool)}
+	if len(args) > 0 {
+		m.name, m.params = args[0], args[1:]
+	}
+	missing := p.errorAt(0, dirMacro, "missing %s for macro %s", dirEndMacro, m.name)
+
+	for {
+		// a definition in an included file or a macro body ends with it
+		if p.frameEnded() || !p.readLine() {
+			if err == nil {
+				err = missing
+			}
+			break
+		}
+
+		cmd := p.trimComment(strings.TrimSpace(p.raw))
+		if fields := strings.Fields(cmd); len(fields) > 0 {
+			if fields[0] == dirEndMacro {
+				break
+			}
+			if fields[0] == dirMacro && err == nil {
+				err = p.errorAt(0, dirMacro, "nested macro definition in macro %s", m.name)
+			}
+		}
+
+		// collect labels defined in the body, except anonymous ones, which are
+		// resolved forward or backward in each expansion without renaming
+		if len(cmd) > 2 && cmd[0] == '(' && cmd[len(cmd)-1] == ')' {
+			if label := cmd[1 : len(cmd)-1]; !symbtbl.IsAnonLabel(label) {
+				m.labels[label] = true
+			}
+		}
+		m.body = append(m.body, line{text: p.raw, pos: p.pos})
+	}
+
+	if err != nil {
+		p.pending = err
+		return
+	}
+	p.macros[m.name] = m
+}
+
+// expand starts an expansion of the macro m with arguments args.
+func (p *Parser) expand(m *macro, args string) {
+	argv := splitArgs(args)
+	if len(argv) != len(m.params) {
+		p.pending = p.Errorf(m.name, "macro %s takes %d arguments, but got %d", m.name, len(m.params), len(argv))
+		return
+	}
+	if len(p.frames) >= maxMacroDepth {
+		p.pending = p.Errorf(m.name, "macro %s nested too deeply", m.name)
+		return
+	}
+
+	p.nexp++
+	repl := make(map[string]string, len(m.params)+len(m.labels))
+	for label := range m.labels {
+		repl[label] = fmt.Sprintf("%s$%s.%d", m.name, label, p.nexp)
+	}
+	for i, param := range m.params {
+		repl[param] = argv[i]
+	}
+
+	lines := make([]line, len(m.body))
+	for i, l := range m.body {
+		lines[i] = line{text: substitute(l.text, repl), pos: l.pos}
+	}
+
+	p.frames = append(p.frames, &frame{
+		lines: lines,
+		note:  Note{Pos: p.posAt(0), Msg: "in expansion of macro " + m.name},
+	})
+}
+
+// frameEnded reports whether all the lines in the innermost frame have been read.
+// It is false if no frame is pushed, where the lines are read from the input.
+func (p *Parser) frameEnded() bool {
+	if len(p.frames) == 0 {
+		return false
+	}
+	f := p.frames[len(p.frames)-1]
+	return f.next >= len(f.lines)
+}
+
+// frameNotes returns the call sites of the macros being expanded and
+// the positions of the include directives being processed, innermost first.
+func (p *Parser) frameNotes() []Note {
+	notes := make([]Note, len(p.frames))
+	for i, f := range p.frames {
+		notes[len(p.frames)-1-i] = f.note
+	}
+	return notes
+}
+
+// frameOrigin returns the position of the line in a source file from which the line at pos
+// in the innermost frame comes: the call site of the outermost macro being expanded in
+// the innermost file, or pos itself if the line is not in a macro expansion.
+func (p *Parser) frameOrigin(pos Pos) Pos {
+	for i := len(p.frames) - 1; i >= 0 && p.frames[i].file == ""; i-- {
+		pos = p.frames[i].note.Pos
+	}
+	return pos
+}
+
+// reserved reports whether name is a register, a mnemonic or a pre-defined symbol,
+// which would be replaced in the instructions of a macro body if it were a parameter.
+func (p *Parser) reserved(name string) bool {
+	return p.code.IsValidDest(name) || p.code.IsValidComp(name) || p.code.IsValidJump(name) || p.symbs[name]
+}
+
+// splitArgs splits s into arguments separated by commas or white spaces.
+func splitArgs(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// substitute replaces each symbol in text which is a key of repl with its value.
+// The comment in text is removed, and character literals such as 'A' are left as they are.
+func substitute(text string, repl map[string]string) string {
+	if i := strings.Index(text, prefixComment); i >= 0 {
+		text = strings.TrimRight(text[:i], " \t")
+	}
+
+	var buf strings.Builder
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == '\'' && i+2 < len(text) && text[i+2] == '\'':
+			buf.WriteString(text[i : i+3])
+			i += 3
+		case symbtbl.IsSymbolChar(c):
+			j := i
+			for j < len(text) && symbtbl.IsSymbolChar(text[j]) {
+				j++
+			}
+			if v, found := repl[text[i:j]]; found {
+				buf.WriteString(v)
+			} else {
+				buf.WriteString(text[i:j])
+			}
+			i = j
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,176 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testMacroAsm = `.macro PUSHD
+	@SP
+	AM=M+1
+	A=A-1
+	M=D
+.endm
+
+.macro WAIT addr, mask   // wait until RAM[addr] & mask != 0
+(LOOP)
+	@addr
+	D=M
+	@mask
+	D=D&A
+	@LOOP
+	D;JEQ
+.endm
+
+.macro PUSHC c
+	@c
+	D=A
+	PUSHD
+.endm
+
+	WAIT KBD, 0xFF
+	PUSHC 'A'
+	WAIT R0 1
+`
+
+func TestMacro(t *testing.T) {
+	want := []string{
+		"(WAIT$LOOP.1)", "@KBD", "D=M", "@0xFF", "D=D&A", "@WAIT$LOOP.1", "D;JEQ",
+		"@'A'", "D=A", "@SP", "AM=M+1", "A=A-1", "M=D",
+		"(WAIT$LOOP.4)", "@R0", "D=M", "@1", "D=D&A", "@WAIT$LOOP.4", "D;JEQ",
+	}
+
+	p := NewParser(strings.NewReader(testMacroAsm))
+	var got []string
+	for p.HasMoreCommands() {
+		if e := p.Advance(); e != nil {
+			t.Fatalf("Advance failed: %s", e.Error())
+		}
+		got = append(got, p.command.cmd)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+	}
+	if p.ROMAddr() != 17 {
+		t.Errorf("ROM address: got = %d; want = 17", p.ROMAddr())
+	}
+}
+
+func TestMacroAnonLabel(t *testing.T) {
+	src := ".macro WAIT n\n\t@n\n\tD=A\n(1)\n\tD=D-1\n\t@1b\n\tD;JGT\n\t@1f\n\t0;JMP\n(1)\n.endm\nWAIT 5\n"
+	want := []string{"@5", "D=A", "(1)", "D=D-1", "@1b", "D;JGT", "@1f", "0;JMP", "(1)"}
+
+	p := NewParser(strings.NewReader(src))
+	var got []string
+	for p.HasMoreCommands() {
+		if e := p.Advance(); e != nil {
+			t.Fatalf("Advance failed: %s", e.Error())
+		}
+		got = append(got, p.command.cmd)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestMacroErrorNotes(t *testing.T) {
+	src := ".macro INC x\n\t@x\n\tM=M+2\n.endm\n.macro INC2 y\n\tINC y\n.endm\n@0\nINC2 i\n"
+
+	p := NewParser(strings.NewReader(src))
+	p.SetFileName("m.asm")
+
+	var err error
+	for err == nil && p.HasMoreCommands() {
+		err = p.Advance()
+	}
+
+	want := &Error{
+		Pos:    Pos{"m.asm", 3, 4},
+		Token:  "M+2",
+		Source: "\tM=M+2",
+		Msg:    `invalid comp command: "M+2"`,
+		Notes: []Note{
+			{Pos{"m.asm", 6, 2}, "in expansion of macro INC"},
+			{Pos{"m.asm", 9, 1}, "in expansion of macro INC2"},
+		},
+	}
+	if !reflect.DeepEqual(err, want) {
+		t.Fatalf("got:  %#v\nwant: %#v", err, want)
+	}
+
+	wantMsg := "m.asm:3:4: invalid comp command: \"M+2\"\n" +
+		"\tm.asm:6:2: in expansion of macro INC\n" +
+		"\tm.asm:9:1: in expansion of macro INC2"
+	if err.Error() != wantMsg {
+		t.Errorf("got:\n%s\nwant:\n%s", err.Error(), wantMsg)
+	}
+}
+
+func TestMacroError(t *testing.T) {
+	macroErrorTests := []struct {
+		src  string
+		want []string
+	}{
+		{".macro\n.endm", []string{"1:1: missing macro name"}},
+		{".macro 1A\n.endm", []string{"1:8: invalid macro name: 1A"}},
+		{".macro D\n.endm", []string{"1:8: macro name D is a register, a mnemonic or a pre-defined symbol"}},
+		{".macro SCREEN x\n.endm", []string{"1:8: macro name SCREEN is a register, a mnemonic or a pre-defined symbol"}},
+		{".macro F x, x\n.endm", []string{"1:13: invalid or duplicate parameter x in macro F"}},
+		{".macro F D\n.endm", []string{"1:10: parameter D in macro F is a register, a mnemonic or a pre-defined symbol"}},
+		{".macro F x, JMP\n.endm", []string{"1:13: parameter JMP in macro F is a register, a mnemonic or a pre-defined symbol"}},
+		{".macro F MD\n.endm", []string{"1:10: parameter MD in macro F is a register, a mnemonic or a pre-defined symbol"}},
+		{".macro F SCREEN\n.endm", []string{"1:10: parameter SCREEN in macro F is a register, a mnemonic or a pre-defined symbol"}},
+		{".macro F\n.endm\n.macro F\n.endm", []string{"3:8: macro F redefined"}},
+		{".macro F\n@1", []string{"1:1: missing .endm for macro F"}},
+		{".macro F\n.macro B\n.endm", []string{"2:1: nested macro definition in macro F"}},
+		{".endm", []string{"1:1: .endm without .macro"}},
+		{".macro F x\n@x\n.endm\nF\nF 1, 2\nF 3", []string{
+			"4:1: macro F takes 1 arguments, but got 0",
+			"5:1: macro F takes 1 arguments, but got 2",
+		}},
+		{".macro F\nF\n.endm\nF", []string{"2:1: macro F nested too deeply"}},
+	}
+
+	for _, tt := range macroErrorTests {
+		p := NewParser(strings.NewReader(tt.src))
+		p.DefineSymbols(map[string]uintptr{"SCREEN": 0x4000})
+
+		var got []string
+		for p.HasMoreCommands() {
+			if e := p.Advance(); e != nil {
+				// report only the innermost position
+				got = append(got, e.(*Error).Pos.String()+": "+e.(*Error).Msg)
+			}
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("src %q:\ngot:  %q\nwant: %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	repl := map[string]string{"x": "R1", "LOOP": "M$LOOP.1"}
+
+	substituteTests := []struct {
+		text string
+		want string
+	}{
+		{"@x", "@R1"},
+		{"(LOOP)", "(M$LOOP.1)"},
+		{"@LOOP // x", "@M$LOOP.1"},
+		{"\tM=x// x", "\tM=R1"},
+		{"@x.y", "@x.y"},
+		{"@'x'+x", "@'x'+R1"},
+		{"D=M", "D=M"},
+	}
+
+	for _, tt := range substituteTests {
+		if got := substitute(tt.text, repl); got != tt.want {
+			t.Errorf("substitute(%q) = %q; want %q", tt.text, got, tt.want)
+		}
+	}
+}
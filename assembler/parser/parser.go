@@ -2,7 +2,6 @@ package parser
 
 import (
 	"bufio"
-	"fmt"
 	"io"
 	"strings"
 
@@ -12,6 +11,8 @@ import (
 const (
 	// prefixComment is a prefix of a comment.
 	prefixComment = "//"
+	// prefixDirective is a prefix of a directive.
+	prefixDirective = '.'
 )
 
 // CommandType represents a type of a Hack command.
@@ -24,6 +25,8 @@ const (
 	CCommand
 	// LCommand means (Xxx) pseudo command.
 	LCommand
+	// DCommand means .xxx args directive.
+	DCommand
 )
 
 type command struct {
@@ -33,6 +36,7 @@ type command struct {
 	dest string
 	comp string
 	jump string
+	args []string
 }
 
 // Parser is a parser for Hack assembly language.
@@ -40,7 +44,22 @@ type command struct {
 type Parser struct {
 	in      *bufio.Scanner
 	err     error
+	file    string
+	lineno  int    // line number in input
+	pos     Pos    // position of the current line
+	notes   []Note // where the current line comes from
+	origin  Pos    // position of the line in a source file from which the current line comes
+	raw     string
 	line    string
+	pending *Error // error found while reading lines, which is returned by the next Advance
+	macros  map[string]*macro
+	symbs   map[string]bool // pre-defined symbols, which cannot be macro parameters
+	frames  []*frame        // stack of macro expansions and included files in progress
+	nexp    int             // number of macro expansions so far
+	incdirs []string        // directories to search for included files
+	scope   string          // last global label, to which local labels belong
+	code    code.Code
+	strict  bool // whether white spaces in C instructions are rejected
 	command command
 	romaddr uintptr
 }
@@ -49,100 +68,245 @@ type Parser struct {
 func NewParser(r io.Reader) *Parser {
 	ptr := uintptr(0)
 	return &Parser{
-		in: bufio.NewScanner(r),
+		in:     bufio.NewScanner(r),
+		macros: map[string]*macro{},
 		// initialize to the max value of uintptr
 		// in order to set romaddr as 0 in the first increment
 		romaddr: ptr - 1,
 	}
 }
 
+// SetFileName sets the name of the source file, which is used in diagnostics
+// and to search for included files.
+func (p *Parser) SetFileName(name string) {
+	p.file = name
+}
+
+// SetIncludePaths sets directories to search for included files.
+// A file is searched in the directory of the including file first,
+// and then in dirs in order.
+func (p *Parser) SetIncludePaths(dirs []string) {
+	p.incdirs = dirs
+}
+
+// DefineSymbols tells the parser the pre-defined symbols, which cannot be used as
+// the names of macro parameters.
+func (p *Parser) DefineSymbols(sym map[string]uintptr) {
+	if p.symbs == nil {
+		p.symbs = make(map[string]bool, len(sym))
+	}
+	for name := range sym {
+		p.symbs[name] = true
+	}
+}
+
+// SetStrict sets whether the parser accepts only C instructions in the official form.
+// By default, it also accepts white spaces and relaxed spellings of mneumonics
+// such as D = M + D; JMP, which are normalized into the official form.
+func (p *Parser) SetStrict(strict bool) {
+	p.strict = strict
+	p.code.SetStrict(strict)
+}
+
+// SetExtended sets whether the parser accepts the shift instructions in the extended
+// instruction set, such as D=D<< and M=M>>.
+func (p *Parser) SetExtended(extended bool) {
+	p.code.SetExtended(extended)
+}
+
 // HasMoreCommands reports whether there exist more commands in input.
+// Macro definitions are consumed, and macro calls and include directives are expanded here,
+// so the following commands come from the macro body or the included file.
 func (p *Parser) HasMoreCommands() bool {
 	if p.err != nil {
 		return false
 	}
 
-	// if Scan() == true && Text() is not a comment, return true
-	// if Scan() == false, return false
-	for p.in.Scan() {
+	// if readLine() == true && the line is not a comment, return true
+	// if readLine() == false, return false
+	for p.readLine() {
 		// trim all leading and trailing white spaces
-		p.line = strings.TrimSpace(p.in.Text())
+		p.line = strings.TrimSpace(p.raw)
+
+		// skip the line if it is empty or a comment
+		if p.line == "" || strings.HasPrefix(p.line, prefixComment) {
+			continue
+		}
 
-		// return true if the line is not empty and not a comment, that is, a command
-		if p.line != "" && !strings.HasPrefix(p.line, prefixComment) {
+		// return true if the line is a command, or an error is found in a macro
+		if !p.preprocess() || p.pending != nil {
 			return true
 		}
 	}
+	p.err = p.in.Err()
 	return false
 }
 
+// readLine reads the next line into p.raw from the innermost macro expansion or
+// included file, or from input if there is neither of them. It returns false at the end of input.
+func (p *Parser) readLine() bool {
+	for len(p.frames) > 0 {
+		f := p.frames[len(p.frames)-1]
+		if f.next < len(f.lines) {
+			l := f.lines[f.next]
+			f.next++
+			p.raw, p.pos, p.notes, p.origin = l.text, l.pos, p.frameNotes(), p.frameOrigin(l.pos)
+			return true
+		}
+		// the expansion or the included file is finished
+		p.frames = p.frames[:len(p.frames)-1]
+	}
+
+	if !p.in.Scan() {
+		return false
+	}
+	p.lineno++
+	p.raw = p.in.Text()
+	p.pos = Pos{File: p.file, Line: p.lineno}
+	p.notes = nil
+	p.origin = p.pos
+	return true
+}
+
+// Err returns the first non-EOF error that was encountered while reading input.
+func (p *Parser) Err() error {
+	return p.err
+}
+
 // ROMAddr returns current ROM address.
 func (p *Parser) ROMAddr() uintptr {
 	return p.romaddr
 }
 
+// Pos returns the position of the current command.
+func (p *Parser) Pos() Pos {
+	return p.posAt(0)
+}
+
+// Source returns the source line of the current command.
+func (p *Parser) Source() string {
+	return p.raw
+}
+
+// Errorf returns a diagnostic about tok in the current command.
+// The column points at the first occurrence of tok in the command,
+// or at the beginning of the command if tok is not found.
+func (p *Parser) Errorf(tok string, format string, args ...interface{}) *Error {
+	return p.Site().Errorf(tok, format, args...)
+}
+
+// errorAt returns a diagnostic about tok which starts at offset off in the current command.
+func (p *Parser) errorAt(off int, tok string, format string, args ...interface{}) *Error {
+	return p.Site().errorAt(off, tok, format, args...)
+}
+
+// posAt returns the position of offset off in the current command.
+func (p *Parser) posAt(off int) Pos {
+	return p.Site().posAt(off)
+}
+
+// Site returns the site of the current command, which can make diagnostics about
+// the command after the parser goes on to the following commands.
+func (p *Parser) Site() Site {
+	return Site{pos: p.pos, raw: p.raw, line: p.line, notes: p.notes, origin: p.origin}
+}
+
 // Advance reads next command from input and set the command to current one.
-// If the next command is invalid, it returns an error.
+// If the next command is invalid, it returns an *Error. The error is not sticky,
+// so the caller can go on to the next command to find more errors.
 // This method should be called only if hasMoreCommands() returns true.
 func (p *Parser) Advance() error {
 	if p.err != nil {
 		return p.err
 	}
+	if e := p.pending; e != nil {
+		p.pending = nil
+		return e
+	}
 
 	// trim a comment and get a pure command string
 	cmd := p.trimComment(p.line)
 	var typ CommandType
 	var symb, dest, comp, jump string
+	var args []string
 
 	switch cmd[0] {
 	// assginment command
 	case '@':
 		typ = ACommand
-		symb = cmd[1:]
 		p.romaddr++
+		var err *Error
+		if symb, err = p.qualify(strings.TrimSpace(cmd[1:])); err != nil {
+			return err
+		}
 	// lobal command
 	case '(':
 		lastc := cmd[len(cmd)-1]
 		if lastc != ')' {
-			p.err = fmt.Errorf("label command should be closed with ')', but got %s", string(lastc))
-			return p.err
+			return p.errorAt(len(cmd)-1, string(lastc), "label command should be closed with ')', but got %s", string(lastc))
 		}
 		typ = LCommand
 		symb = cmd[1 : len(cmd)-1]
+		if symb == "" {
+			return p.errorAt(0, cmd, "missing label name")
+		}
+		var err *Error
+		if symb, err = p.label(symb); err != nil {
+			return err
+		}
+	// directive
+	case prefixDirective:
+		fields := strings.Fields(cmd[1:])
+		if len(fields) == 0 {
+			return p.errorAt(0, cmd, "missing directive name")
+		}
+		typ = DCommand
+		symb = fields[0]
+		args = fields[1:]
 	// computation command
 	default:
-		var cod code.Code
+		// count up ROM address even if the command is invalid
+		// so that the addresses of the following labels stay correct
+		p.romaddr++
+
+		if i := strings.IndexAny(cmd, " \t"); i >= 0 && p.strict {
+			return p.errorAt(i, cmd[i:i+1], "white spaces in C instruction are not allowed in strict mode: %q", cmd)
+		}
+
 		s1 := p.splitCmd(cmd, "=")
 		// next parse target command
 		next := s1[0]
+		off := 0
 		if len(s1) == 2 {
 			// check whether dest command is valid
-			if !cod.IsValidDest(s1[0]) {
-				p.err = fmt.Errorf("invalid dest command: %s", s1[0])
-				return p.err
+			var ok bool
+			if dest, ok = p.code.NormalizeDest(s1[0]); !ok {
+				tok := strings.TrimSpace(s1[0])
+				return p.errorAt(0, tok, "invalid dest command: %s", tok)
 			}
-			dest = s1[0]
 			// replace next parse target command
 			next = s1[1]
+			off = len(s1[0]) + 1
 		}
 		// split next parse target command
 		s2 := p.splitCmd(next, ";")
 		// check whether comp command is valid
-		if !cod.IsValidComp(s2[0]) {
-			p.err = fmt.Errorf("invalid comp command: \"%s\"", s2[0])
-			return p.err
+		var ok bool
+		if comp, ok = p.code.NormalizeComp(s2[0]); !ok {
+			tok, skip := trimToken(s2[0])
+			if p.code.IsExtended(tok) {
+				return p.errorAt(off+skip, tok, "comp command %s is in the extended instruction set, which is enabled by -ext option", tok)
+			}
+			return p.errorAt(off+skip, tok, "invalid comp command: \"%s\"", tok)
 		}
-		comp = s2[0]
 		if len(s2) == 2 {
 			// check whether jump command is valid
-			if !cod.IsValidJump(s2[1]) {
-				p.err = fmt.Errorf("invalid jump command: %s", s2[1])
-				return p.err
+			if jump, ok = p.code.NormalizeJump(s2[1]); !ok {
+				tok, skip := trimToken(s2[1])
+				return p.errorAt(off+len(s2[0])+1+skip, tok, "invalid jump command: %s", tok)
 			}
-			jump = s2[1]
 		}
 		typ = CCommand
-		p.romaddr++
 	}
 
 	// assgin into fields if no error occurs
@@ -153,6 +317,7 @@ func (p *Parser) Advance() error {
 		dest: dest,
 		comp: comp,
 		jump: jump,
+		args: args,
 	}
 
 	return nil
@@ -165,10 +330,23 @@ func (p *Parser) CommandType() CommandType {
 
 // Symbol returns a symbol in a current command. This method should be called
 // only if CommandType() returns aCommand or lCommand.
+// Local labels in the symbol are replaced with their full names, such as MULT.loop.
 func (p *Parser) Symbol() string {
 	return p.command.symb
 }
 
+// Directive returns a directive name without the leading '.' in a current command.
+// This method should be called only if CommandType() returns DCommand.
+func (p *Parser) Directive() string {
+	return p.command.symb
+}
+
+// Args returns whitespace separated arguments of a directive in a current command.
+// This method should be called only if CommandType() returns DCommand.
+func (p *Parser) Args() []string {
+	return p.command.args
+}
+
 // Dest returns a destination in a current command. This method should be called
 // only if CommandType() returns cCommand.
 func (p *Parser) Dest() string {
@@ -199,6 +377,12 @@ func (p *Parser) trimComment(line string) string {
 	return strings.TrimSpace(line[:idx])
 }
 
+// trimToken trims white spaces around tok, and returns it with the number of leading white spaces.
+func trimToken(tok string) (string, int) {
+	trimmed := strings.TrimLeft(tok, " \t")
+	return strings.TrimRight(trimmed, " \t"), len(tok) - len(trimmed)
+}
+
 // splitCmd splits cmd into up to two elements by sep.
 func (p *Parser) splitCmd(cmd string, sep string) []string {
 	return strings.SplitN(cmd, sep, 2)
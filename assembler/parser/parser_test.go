@@ -169,3 +169,188 @@ func TestSplitCmd(t *testing.T) {
 		}
 	}
 }
+
+func TestAdvanceError(t *testing.T) {
+	advanceErrorTests := []struct {
+		src  string
+		want Error
+	}{
+		{"(LOOP", Error{Pos{"a.asm", 1, 5}, "P", "(LOOP", "label command should be closed with ')', but got P", nil, false}},
+		{"  X=D", Error{Pos{"a.asm", 1, 3}, "X", "  X=D", "invalid dest command: X", nil, false}},
+		{"\n\tD=D*A", Error{Pos{"a.asm", 2, 4}, "D*A", "\tD=D*A", `invalid comp command: "D*A"`, nil, false}},
+		{"@0\n0;JJ // jump", Error{Pos{"a.asm", 2, 3}, "JJ", "0;JJ // jump", "invalid jump command: JJ", nil, false}},
+	}
+
+	for _, tt := range advanceErrorTests {
+		p := NewParser(strings.NewReader(tt.src))
+		p.SetFileName("a.asm")
+
+		var err error
+		for err == nil && p.HasMoreCommands() {
+			err = p.Advance()
+		}
+
+		got, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("src %q: got %#v; want *Error", tt.src, err)
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("src %q:\ngot:  %+v\nwant: %+v", tt.src, *got, tt.want)
+		}
+	}
+}
+
+func TestErrorString(t *testing.T) {
+	errorStringTests := []struct {
+		err  Error
+		want string
+	}{
+		{Error{Pos: Pos{"Max.asm", 3, 7}, Msg: "bad"}, "Max.asm:3:7: bad"},
+		{Error{Pos: Pos{"", 12, 1}, Msg: "bad"}, "12:1: bad"},
+		{Error{Pos: Pos{"a.asm", 2, 1}, Msg: "odd", Warning: true}, "a.asm:2:1: warning: odd"},
+	}
+
+	for _, tt := range errorStringTests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("got: %q; want: %q", got, tt.want)
+		}
+	}
+}
+
+func TestAdvanceRecover(t *testing.T) {
+	src := "D=D*A\n@1\nX=0\n(LOOP\n0;JJ\n(END)"
+
+	p := NewParser(strings.NewReader(src))
+	var errs, cmds int
+	for p.HasMoreCommands() {
+		if e := p.Advance(); e != nil {
+			errs++
+			continue
+		}
+		cmds++
+	}
+
+	if errs != 4 || cmds != 2 {
+		t.Errorf("got %d errors and %d commands; want 4 errors and 2 commands", errs, cmds)
+	}
+	if p.ROMAddr() != 0x3 {
+		t.Errorf("ROM address: got = 0x%X but want = 0x3", p.ROMAddr())
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	snippetTests := []struct {
+		err  Error
+		want string
+	}{
+		{Error{Pos: Pos{Column: 2}, Source: "@40000"}, "\t@40000\n\t ^"},
+		{Error{Pos: Pos{Column: 4}, Source: "\t  @-1 // x"}, "\t\t  @-1 // x\n\t\t  ^"},
+		{Error{Pos: Pos{Column: 1}}, ""},
+	}
+
+	for _, tt := range snippetTests {
+		if got := tt.err.Snippet(); got != tt.want {
+			t.Errorf("got: %q; want: %q", got, tt.want)
+		}
+	}
+}
+
+func TestAdvanceDirective(t *testing.T) {
+	p := NewParser(strings.NewReader("  .equ  WIDTH SCREEN + 32 // comment"))
+	if !p.HasMoreCommands() {
+		t.Fatal("HasMoreCommands should not return false")
+	}
+	if e := p.Advance(); e != nil {
+		t.Fatalf("Advance failed: %s", e.Error())
+	}
+
+	if p.CommandType() != DCommand {
+		t.Errorf("command type: got = %d; want = %d", p.CommandType(), DCommand)
+	}
+	if p.Directive() != "equ" {
+		t.Errorf("directive: got = %q; want = %q", p.Directive(), "equ")
+	}
+	if want := []string{"WIDTH", "SCREEN", "+", "32"}; !reflect.DeepEqual(p.Args(), want) {
+		t.Errorf("args: got = %q; want = %q", p.Args(), want)
+	}
+	if p.ROMAddr() != ^uintptr(0) {
+		t.Errorf("a directive should not increment ROM address, but got 0x%X", p.ROMAddr())
+	}
+}
+
+func TestAdvanceRelaxed(t *testing.T) {
+	relaxedTests := []struct {
+		src              string
+		dest, comp, jump string
+	}{
+		{"D = D + M", "D", "D+M", ""},
+		{"MD=M+D", "MD", "D+M", ""},
+		{"DM = A & D ; JNE", "MD", "D&A", "JNE"},
+		{"0 ; JMP // loop", "", "0", "JMP"},
+		{"AM=1+M", "AM", "M+1", ""},
+	}
+
+	for _, tt := range relaxedTests {
+		p := NewParser(strings.NewReader(tt.src))
+		if !p.HasMoreCommands() {
+			t.Fatalf("src %q: HasMoreCommands should not return false", tt.src)
+		}
+		if e := p.Advance(); e != nil {
+			t.Errorf("src %q: Advance failed: %s", tt.src, e.Error())
+			continue
+		}
+		if p.Dest() != tt.dest || p.Comp() != tt.comp || p.Jump() != tt.jump {
+			t.Errorf("src %q: got = (%q, %q, %q); want = (%q, %q, %q)",
+				tt.src, p.Dest(), p.Comp(), p.Jump(), tt.dest, tt.comp, tt.jump)
+		}
+
+		// strict mode keeps rejecting them
+		p = NewParser(strings.NewReader(tt.src))
+		p.SetStrict(true)
+		p.HasMoreCommands()
+		if e := p.Advance(); e == nil {
+			t.Errorf("src %q: Advance should fail in strict mode", tt.src)
+		}
+	}
+
+	// strict mode reports white spaces rather than a valid mneumonic
+	p := NewParser(strings.NewReader("D = D + M"))
+	p.SetStrict(true)
+	p.HasMoreCommands()
+	want := `1:2: white spaces in C instruction are not allowed in strict mode: "D = D + M"`
+	if e := p.Advance(); e == nil || e.Error() != want {
+		t.Errorf("got %v; want %s", e, want)
+	}
+
+	// errors point at the token without spaces
+	p = NewParser(strings.NewReader("D = D * M"))
+	p.HasMoreCommands()
+	want = `1:5: invalid comp command: "D * M"`
+	if e := p.Advance(); e == nil || e.Error() != want {
+		t.Errorf("got %v; want %s", e, want)
+	}
+}
+
+func TestAdvanceExtended(t *testing.T) {
+	src := "D=D<<\nM = M >> ; JNE"
+
+	// the default mode rejects shifts with a hint
+	p := NewParser(strings.NewReader(src))
+	p.HasMoreCommands()
+	want := "1:3: comp command D<< is in the extended instruction set, which is enabled by -ext option"
+	if e := p.Advance(); e == nil || e.Error() != want {
+		t.Errorf("got %v; want %s", e, want)
+	}
+
+	p = NewParser(strings.NewReader(src))
+	p.SetExtended(true)
+	for _, comp := range []string{"D<<", "M>>"} {
+		p.HasMoreCommands()
+		if e := p.Advance(); e != nil {
+			t.Fatalf("Advance failed: %s", e.Error())
+		}
+		if p.Comp() != comp {
+			t.Errorf("comp: got = %q; want = %q", p.Comp(), comp)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package symbtbl
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Entry is an entry of a symbol table.
+type Entry struct {
+	Name    string  `json:"name"`
+	Kind    Kind    `json:"kind"`
+	Address uintptr `json:"address"`
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Entries returns all the entries in st sorted by kind, address and name in that order.
+func (st *SymbolTable) Entries() []Entry {
+	st.mu.RLock()
+	ents := make([]Entry, 0, len(st.m))
+	for symb, addr := range st.m {
+		ents = append(ents, Entry{Name: symb, Kind: st.kinds[symb], Address: addr})
+	}
+	st.mu.RUnlock()
+
+	sort.Slice(ents, func(i, j int) bool {
+		a, b := ents[i], ents[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return a.Name < b.Name
+	})
+	return ents
+}
+
+// WriteSym writes all the entries in st into w, one per line,
+// in the form "ADDR KIND NAME" where ADDR is a 4 digit hex number.
+func (st *SymbolTable) WriteSym(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range st.Entries() {
+		fmt.Fprintf(bw, "%04X %-10s %s\n", e.Address, e.Kind, e.Name)
+	}
+	return bw.Flush()
+}
+
+// WriteJSON writes all the entries in st into w as a JSON array.
+func (st *SymbolTable) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(st.Entries())
+}
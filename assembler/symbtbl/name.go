@@ -0,0 +1,35 @@
+package symbtbl
+
+// IsSymbolChar reports whether c can be a part of a symbol or a numeric literal,
+// which is a letter, a digit, '_', '.', '$' or ':'.
+func IsSymbolChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '_' || c == '.' || c == '$' || c == ':'
+}
+
+// IsSymbol reports whether s is a valid symbol name, which is a sequence of
+// letters, digits, '_', '.', '$' and ':' that does not begin with a digit.
+func IsSymbol(s string) bool {
+	if s == "" || '0' <= s[0] && s[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !IsSymbolChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsAnonLabel reports whether s is an anonymous label such as 1, which consists only of digits.
+func IsAnonLabel(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
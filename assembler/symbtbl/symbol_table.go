@@ -1,12 +1,54 @@
 package symbtbl
 
-import "sync"
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// VarBase is the RAM address of the first variable.
+	VarBase = 0x10
+	// VarLimit is the RAM address next to the last variable,
+	// where the memory map of the screen begins.
+	VarLimit = 0x4000
+)
+
+// Kind represents a kind of a symbol.
+type Kind int
+
+// A list of symbol kinds.
+const (
+	// Predefined means a pre-defined symbol such as SP or SCREEN.
+	Predefined Kind = iota
+	// Label means a label symbol defined by (Xxx) pseudo command.
+	Label
+	// Variable means a variable symbol whose address is automatically allocated.
+	Variable
+	// Constant means a constant symbol defined by .equ directive.
+	Constant
+)
+
+var kindNames = [...]string{
+	Predefined: "predefined",
+	Label:      "label",
+	Variable:   "variable",
+	Constant:   "constant",
+}
+
+// String returns the name of k.
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+	return kindNames[k]
+}
 
 // SymbolTable is a map table of symbol strings and its addresses.
 // SymbolTable is thread safe, so it can be used in multiple goroutines.
 type SymbolTable struct {
 	mu    sync.RWMutex
 	m     map[string]uintptr
+	kinds map[string]Kind
 	vaddr uintptr // variable symbol's address
 }
 
@@ -14,19 +56,26 @@ type SymbolTable struct {
 func NewSymbolTable() *SymbolTable {
 	return &SymbolTable{
 		m:     map[string]uintptr{},
-		vaddr: 0x10,
+		kinds: map[string]Kind{},
+		vaddr: VarBase,
 	}
 }
 
-// AddEntry adds a pair (symb, addr) into the symbol table st.
+// AddEntry adds a pair (symb, addr) into the symbol table st as a label symbol.
 func (st *SymbolTable) AddEntry(symb string, addr uintptr) {
+	st.addEntry(symb, addr, Label)
+}
+
+// addEntry adds a pair (symb, addr) of the kind k into the symbol table st.
+func (st *SymbolTable) addEntry(symb string, addr uintptr, k Kind) {
 	st.mu.Lock()
 	defer st.mu.Unlock()
 
 	st.m[symb] = addr
+	st.kinds[symb] = k
 }
 
-// AddEntries adds all the elements of m into the symbol table st.
+// AddEntries adds all the elements of m into the symbol table st as pre-defined symbols.
 func (st *SymbolTable) AddEntries(ent map[string]uintptr) {
 	st.mu.Lock()
 	defer st.mu.Unlock()
@@ -34,6 +83,7 @@ func (st *SymbolTable) AddEntries(ent map[string]uintptr) {
 	// copy the given map to ensure an internal map is not changed by external reference.
 	for k, v := range ent {
 		st.m[k] = v
+		st.kinds[k] = Predefined
 	}
 }
 
@@ -55,14 +105,43 @@ func (st *SymbolTable) GetAddress(symb string) uintptr {
 	return st.m[symb]
 }
 
+// AddConst adds a constant symbol symb whose value is v into st.
+func (st *SymbolTable) AddConst(symb string, v uintptr) {
+	st.addEntry(symb, v, Constant)
+}
+
+// Kind returns the kind of symb. If symb is not contained in st, found is false.
+func (st *SymbolTable) Kind(symb string) (k Kind, found bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	k, found = st.kinds[symb]
+	return k, found
+}
+
 // AddVar adds a variable symbol into st. The variable symbol's address is automatically set.
 //
 // A variable symbol's address is 16 (0x10) in the inital state,
 // and every time a symbol is added it is automatically incremented by 1.
-func (st *SymbolTable) AddVar(symb string) {
-	st.AddEntry(symb, st.vaddr)
-
+// If the address reaches VarLimit, the variable collides with the memory-mapped I/O,
+// so AddVar returns an error without adding it.
+func (st *SymbolTable) AddVar(symb string) error {
 	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.vaddr >= VarLimit {
+		return fmt.Errorf("no RAM left for variable %s: variables must be below SCREEN (0x%04X)", symb, VarLimit)
+	}
+	st.m[symb] = st.vaddr
+	st.kinds[symb] = Variable
 	st.vaddr++
-	st.mu.Unlock()
+	return nil
+}
+
+// NumVars returns the number of variables allocated in st.
+func (st *SymbolTable) NumVars() int {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	return int(st.vaddr - VarBase)
 }
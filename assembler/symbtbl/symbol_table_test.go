@@ -1,6 +1,8 @@
 package symbtbl
 
 import (
+	"bytes"
+	"fmt"
 	"reflect"
 	"testing"
 )
@@ -88,3 +90,151 @@ func TestAddVar(t *testing.T) {
 		}
 	}
 }
+
+func TestKind(t *testing.T) {
+	st := NewSymbolTable()
+	st.AddEntries(map[string]uintptr{"SP": 0x0})
+	st.AddEntry("LOOP", 0x4)
+	st.AddVar("i")
+	st.AddConst("WIDTH", 32)
+
+	kindTests := []struct {
+		symb  string
+		want  Kind
+		found bool
+	}{
+		{"SP", Predefined, true},
+		{"LOOP", Label, true},
+		{"i", Variable, true},
+		{"WIDTH", Constant, true},
+		{"no", Predefined, false},
+	}
+
+	for _, tt := range kindTests {
+		got, found := st.Kind(tt.symb)
+		if got != tt.want || found != tt.found {
+			t.Errorf("symbol %s: got = (%v, %v); want = (%v, %v)", tt.symb, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestWriteSym(t *testing.T) {
+	st := NewSymbolTable()
+	st.AddEntries(map[string]uintptr{"SCREEN": 0x4000, "R0": 0x0, "SP": 0x0})
+	st.AddVar("j")
+	st.AddEntry("END", 0x12)
+	st.AddVar("i")
+	st.AddEntry("LOOP", 0x4)
+
+	want := `0000 predefined R0
+0000 predefined SP
+4000 predefined SCREEN
+0004 label      LOOP
+0012 label      END
+0010 variable   j
+0011 variable   i
+`
+
+	var buf bytes.Buffer
+	if e := st.WriteSym(&buf); e != nil {
+		t.Fatalf("WriteSym failed: %s", e.Error())
+	}
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	st := NewSymbolTable()
+	st.AddEntries(map[string]uintptr{"KBD": 0x6000})
+	st.AddEntry("LOOP", 0x4)
+	st.AddVar("i")
+
+	want := `[
+  {
+    "name": "KBD",
+    "kind": "predefined",
+    "address": 24576
+  },
+  {
+    "name": "LOOP",
+    "kind": "label",
+    "address": 4
+  },
+  {
+    "name": "i",
+    "kind": "variable",
+    "address": 16
+  }
+]
+`
+
+	var buf bytes.Buffer
+	if e := st.WriteJSON(&buf); e != nil {
+		t.Fatalf("WriteJSON failed: %s", e.Error())
+	}
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestAddVarLimit(t *testing.T) {
+	st := NewSymbolTable()
+	for i := VarBase; i < VarLimit; i++ {
+		if e := st.AddVar(fmt.Sprintf("v%d", i)); e != nil {
+			t.Fatalf("AddVar failed at 0x%04X: %s", i, e.Error())
+		}
+	}
+	if n := st.NumVars(); n != VarLimit-VarBase {
+		t.Errorf("NumVars: got = %d; want = %d", n, VarLimit-VarBase)
+	}
+
+	err := st.AddVar("x")
+	want := "no RAM left for variable x: variables must be below SCREEN (0x4000)"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v; want %s", err, want)
+	}
+	if st.Contains("x") {
+		t.Error("x should not be added")
+	}
+}
+
+func TestIsSymbol(t *testing.T) {
+	isSymbolTests := []struct {
+		s    string
+		want bool
+	}{
+		{"LOOP", true},
+		{"Sys.init$ret.1", true},
+		{"_a:b", true},
+		{"1f", false},
+		{"A B", false},
+		{"a-b", false},
+		{"", false},
+	}
+
+	for _, tt := range isSymbolTests {
+		if got := IsSymbol(tt.s); got != tt.want {
+			t.Errorf("IsSymbol(%q) = %v; want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestIsAnonLabel(t *testing.T) {
+	isAnonLabelTests := []struct {
+		s    string
+		want bool
+	}{
+		{"1", true},
+		{"42", true},
+		{"1f", false},
+		{"L1", false},
+		{"", false},
+	}
+
+	for _, tt := range isAnonLabelTests {
+		if got := IsAnonLabel(tt.s); got != tt.want {
+			t.Errorf("IsAnonLabel(%q) = %v; want %v", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// Package cpu emulates the Hack computer: the Hack CPU, 32K words of ROM and RAM,
+// and the memory maps of the screen and the keyboard.
+package cpu
+
+import "fmt"
+
+const (
+	// ROMSize is the number of words in ROM.
+	ROMSize = 0x8000
+	// RAMSize is the number of words in RAM, including the memory maps.
+	RAMSize = 0x8000
+	// Screen is the base address of the memory map of the screen.
+	Screen = 0x4000
+	// ScreenSize is the number of words in the memory map of the screen.
+	ScreenSize = 0x2000
+	// KBD is the address of the memory map of the keyboard, which is the last valid RAM address.
+	KBD = 0x6000
+)
+
+const (
+	// prefixC is the 3 bit prefix of a C instruction.
+	prefixC = 0x7
+	// prefixExt is the 3 bit prefix of a shift instruction in the extended instruction set.
+	prefixExt = 0x5
+
+	// the bits of dest in an instruction
+	destA = 0x20
+	destD = 0x10
+	destM = 0x08
+)
+
+// Error is an error found in executing an instruction.
+type Error struct {
+	PC   uint16 // ROM address of the instruction
+	Inst uint16
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("ROM[%d] (%016b): %s", e.PC, e.Inst, e.Msg)
+}
+
+// CPU is a Hack computer. The zero value is a computer with empty ROM and RAM.
+// CPU is not thread safe, so it should not be used in multiple goroutines.
+type CPU struct {
+	a, d, pc uint16
+	cycles   uint64
+	rom      [ROMSize]uint16
+	ram      [RAMSize]uint16
+}
+
+// New creates a new Hack computer with empty ROM and RAM.
+func New() *CPU {
+	return &CPU{}
+}
+
+// Load replaces the contents of ROM with words, and resets c.
+func (c *CPU) Load(words []uint16) error {
+	if len(words) > ROMSize {
+		return fmt.Errorf("program of %d words exceeds ROM size of %d words", len(words), ROMSize)
+	}
+	n := copy(c.rom[:], words)
+	for i := n; i < ROMSize; i++ {
+		c.rom[i] = 0
+	}
+	c.Reset()
+	return nil
+}
+
+// Reset sets PC to 0 and the cycle count to 0, as the reset bit of the Hack computer does.
+// The registers and RAM are kept.
+func (c *CPU) Reset() {
+	c.pc = 0
+	c.cycles = 0
+}
+
+// A returns the value of A register.
+func (c *CPU) A() uint16 {
+	return c.a
+}
+
+// SetA sets the value of A register.
+func (c *CPU) SetA(v uint16) {
+	c.a = v
+}
+
+// D returns the value of D register.
+func (c *CPU) D() uint16 {
+	return c.d
+}
+
+// SetD sets the value of D register.
+func (c *CPU) SetD(v uint16) {
+	c.d = v
+}
+
+// PC returns the ROM address of the next instruction.
+func (c *CPU) PC() uint16 {
+	return c.pc
+}
+
+// SetPC sets the ROM address of the next instruction.
+func (c *CPU) SetPC(addr uint16) {
+	c.pc = addr & (ROMSize - 1)
+}
+
+// Cycles returns the number of instructions executed since the last reset.
+func (c *CPU) Cycles() uint64 {
+	return c.cycles
+}
+
+// ROM returns the word at addr in ROM.
+func (c *CPU) ROM(addr uint16) uint16 {
+	return c.rom[addr&(ROMSize-1)]
+}
+
+// SetROM sets the word at addr in ROM.
+func (c *CPU) SetROM(addr, v uint16) {
+	c.rom[addr&(ROMSize-1)] = v
+}
+
+// RAM returns the word at addr in RAM. Addresses above KBD read as 0.
+func (c *CPU) RAM(addr uint16) uint16 {
+	if addr > KBD {
+		return 0
+	}
+	return c.ram[addr]
+}
+
+// SetRAM sets the word at addr in RAM. Unlike instructions, SetRAM can write into KBD
+// to simulate a key press. Writes to addresses above KBD are ignored.
+func (c *CPU) SetRAM(addr, v uint16) {
+	if addr > KBD {
+		return
+	}
+	c.ram[addr] = v
+}
+
+// Screen returns the memory map of the screen. Modifications of the returned slice
+// are reflected in RAM.
+func (c *CPU) Screen() []uint16 {
+	return c.ram[Screen : Screen+ScreenSize]
+}
+
+// SetKey sets the key code of the key being pressed, or 0 if no key is pressed.
+func (c *CPU) SetKey(code uint16) {
+	c.ram[KBD] = code
+}
+
+// Run executes up to n instructions. It stops at the first error.
+func (c *CPU) Run(n int) error {
+	for i := 0; i < n; i++ {
+		if e := c.Step(); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// Step executes the instruction at PC. If the instruction is invalid or accesses
+// an illegal RAM address, Step returns an *Error and the state of c is not changed.
+//
+// Besides the C instructions with the prefix 111, Step executes the shift
+// instructions with the prefix 101 in the extended instruction set.
+func (c *CPU) Step() error {
+	inst := c.rom[c.pc]
+
+	// A instruction: 0vvvvvvvvvvvvvvv
+	if inst&0x8000 == 0 {
+		c.a = inst
+		c.next()
+		return nil
+	}
+
+	// C instruction: 111a cccc ccdd djjj
+	comp := inst >> 6 & 0x7F
+	prefix := inst >> 13
+	switch {
+	case prefix == prefixExt && comp&0xF != 0:
+		return c.errorf(inst, "invalid shift instruction")
+	case prefix != prefixC && prefix != prefixExt:
+		return c.errorf(inst, "invalid instruction")
+	}
+
+	// M is accessed only if the instruction reads or writes it
+	useM := comp&0x40 != 0
+	if (useM || inst&destM != 0) && c.a > KBD {
+		return c.errorf(inst, "illegal memory address %d in A register for M", c.a)
+	}
+	y := c.a
+	if useM {
+		y = c.ram[c.a]
+	}
+
+	var out uint16
+	if prefix == prefixC {
+		out = alu(c.d, y, comp)
+	} else {
+		out = shift(c.d, y, comp)
+	}
+
+	// M is written into the address in A register before A register is updated
+	if inst&destM != 0 && c.a != KBD {
+		c.ram[c.a] = out
+	}
+	jump := isJump(out, inst&0x7)
+	target := c.a
+	if inst&destA != 0 {
+		c.a = out
+	}
+	if inst&destD != 0 {
+		c.d = out
+	}
+	if jump {
+		c.pc = target & (ROMSize - 1)
+		c.cycles++
+		return nil
+	}
+	c.next()
+	return nil
+}
+
+// next advances PC to the next instruction and counts a cycle.
+func (c *CPU) next() {
+	c.pc = (c.pc + 1) & (ROMSize - 1)
+	c.cycles++
+}
+
+// errorf returns an *Error about inst at PC.
+func (c *CPU) errorf(inst uint16, format string, args ...interface{}) *Error {
+	return &Error{PC: c.pc, Inst: inst, Msg: fmt.Sprintf(format, args...)}
+}
+
+// alu computes x and y by the Hack ALU with the control bits in the lower 6 bits of comp,
+// which are zx, nx, zy, ny, f and no from the top.
+func alu(x, y, comp uint16) uint16 {
+	if comp&0x20 != 0 {
+		x = 0
+	}
+	if comp&0x10 != 0 {
+		x = ^x
+	}
+	if comp&0x08 != 0 {
+		y = 0
+	}
+	if comp&0x04 != 0 {
+		y = ^y
+	}
+	var out uint16
+	if comp&0x02 != 0 {
+		out = x + y
+	} else {
+		out = x & y
+	}
+	if comp&0x01 != 0 {
+		out = ^out
+	}
+	return out
+}
+
+// shift shifts d or y one bit by the shift instruction comp, whose bits are a, left and D
+// from the top followed by 4 zero bits. A right shift keeps the sign bit
+// as the CPU emulator of the official tools does.
+func shift(d, y, comp uint16) uint16 {
+	x := y
+	if comp&0x10 != 0 {
+		x = d
+	}
+	if comp&0x20 != 0 {
+		return x << 1
+	}
+	return uint16(int16(x) >> 1)
+}
+
+// isJump reports whether the jump condition jmp, whose bits are lt, eq and gt
+// from the top, holds for out.
+func isJump(out, jmp uint16) bool {
+	v := int16(out)
+	return v < 0 && jmp&0x4 != 0 || v == 0 && jmp&0x2 != 0 || v > 0 && jmp&0x1 != 0
+}
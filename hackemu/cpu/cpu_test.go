@@ -0,0 +1,241 @@
+package cpu
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/skatsuta/nand2tetris/assembler/asm"
+)
+
+// load assembles src and loads it into a new CPU.
+func load(t *testing.T, src string, ext bool) *CPU {
+	c := New()
+	if _, err := c.LoadAsm(strings.NewReader(src), asm.Options{Extended: ext}); err != nil {
+		t.Fatalf("failed to load %q: %s", src, err.Error())
+	}
+	return c
+}
+
+func TestStepComp(t *testing.T) {
+	// D = 5, A = M = 3
+	const d, a = 5, 3
+	stepCompTests := []struct {
+		comp string
+		want uint16
+	}{
+		{"0", 0},
+		{"1", 1},
+		{"-1", 0xFFFF},
+		{"D", d},
+		{"A", a},
+		{"!D", ^uint16(d)},
+		{"!A", ^uint16(a)},
+		{"-D", 0xFFFB},
+		{"-A", 0xFFFD},
+		{"D+1", d + 1},
+		{"A+1", a + 1},
+		{"D-1", d - 1},
+		{"A-1", a - 1},
+		{"D+A", d + a},
+		{"D-A", d - a},
+		{"A-D", 0xFFFE},
+		{"D&A", d & a},
+		{"D|A", d | a},
+		{"M", a},
+		{"!M", ^uint16(a)},
+		{"-M", 0xFFFD},
+		{"M+1", a + 1},
+		{"M-1", a - 1},
+		{"D+M", d + a},
+		{"D-M", d - a},
+		{"M-D", 0xFFFE},
+		{"D&M", d & a},
+		{"D|M", d | a},
+	}
+
+	for _, tt := range stepCompTests {
+		c := load(t, "@5\nD=A\n@3\nM=A\nD="+tt.comp, false)
+		if e := c.Run(5); e != nil {
+			t.Fatalf("%s: %s", tt.comp, e.Error())
+		}
+		if c.D() != tt.want {
+			t.Errorf("D=%s: got = 0x%04X; want = 0x%04X", tt.comp, c.D(), tt.want)
+		}
+	}
+}
+
+func TestStepShift(t *testing.T) {
+	stepShiftTests := []struct {
+		src  string
+		want uint16
+	}{
+		{"@3\nD=A\nD=D<<", 6},
+		{"@3\nD=A\nD=D>>", 1},
+		{"@3\nD=A<<", 6},
+		{"@3\nM=-1\nD=M>>", 0xFFFF},
+		{"@3\nM=1\nD=M<<", 2},
+	}
+
+	for _, tt := range stepShiftTests {
+		c := load(t, tt.src, true)
+		if e := c.Run(3); e != nil {
+			t.Fatalf("%q: %s", tt.src, e.Error())
+		}
+		if c.D() != tt.want {
+			t.Errorf("%q: got = 0x%04X; want = 0x%04X", tt.src, c.D(), tt.want)
+		}
+	}
+}
+
+func TestStepJump(t *testing.T) {
+	stepJumpTests := []struct {
+		src string
+		pc  uint16
+	}{
+		{"@10\n0;JMP", 10},
+		{"@10\nD=-1\nD;JLT", 10},
+		{"@10\nD=-1\nD;JGE", 3},
+		{"@10\nD=0\nD;JEQ", 10},
+		{"@10\nD=0\nD;JNE", 3},
+		{"@10\nD=1\nD;JGT", 10},
+		{"@10\nD=1\nD;JLE", 3},
+		// the target is the value of A register before the instruction
+		{"@10\nA=1;JMP", 10},
+	}
+
+	for _, tt := range stepJumpTests {
+		c := load(t, tt.src, false)
+		if e := c.Run(strings.Count(tt.src, "\n") + 1); e != nil {
+			t.Fatalf("%q: %s", tt.src, e.Error())
+		}
+		if c.PC() != tt.pc {
+			t.Errorf("%q: PC: got = %d; want = %d", tt.src, c.PC(), tt.pc)
+		}
+	}
+}
+
+func TestStepMemory(t *testing.T) {
+	// M is written into the old address even if A register is updated at the same time
+	c := load(t, "@100\nAM=1\n@SCREEN\nM=-1\n@KBD\nM=1\nD=M", false)
+	c.SetKey(65)
+	if e := c.Run(7); e != nil {
+		t.Fatal(e)
+	}
+	if c.RAM(100) != 1 {
+		t.Errorf("RAM[100]: got = %d; want = 1", c.RAM(100))
+	}
+	if c.Screen()[0] != 0xFFFF {
+		t.Errorf("screen: got = 0x%04X; want = 0xFFFF", c.Screen()[0])
+	}
+	// KBD is read only for the program
+	if c.D() != 65 {
+		t.Errorf("KBD: got = %d; want = 65", c.D())
+	}
+	if c.Cycles() != 7 {
+		t.Errorf("cycles: got = %d; want = 7", c.Cycles())
+	}
+}
+
+func TestStepError(t *testing.T) {
+	stepErrorTests := []struct {
+		words []uint16
+		want  string
+	}{
+		{[]uint16{0x6001, 0xFC10}, "ROM[1] (1111110000010000): illegal memory address 24577 in A register for M"},
+		{[]uint16{0x7FFF, 0xEA88}, "ROM[1] (1110101010001000): illegal memory address 32767 in A register for M"},
+		{[]uint16{0xC000}, "ROM[0] (1100000000000000): invalid instruction"},
+		{[]uint16{0xA7C0}, "ROM[0] (1010011111000000): invalid shift instruction"},
+		// the prefix is checked before the address in A register
+		{[]uint16{0x7FFF, 0xD000}, "ROM[1] (1101000000000000): invalid instruction"},
+		{[]uint16{0x7FFF, 0xB7C0}, "ROM[1] (1011011111000000): invalid shift instruction"},
+	}
+
+	for _, tt := range stepErrorTests {
+		c := New()
+		if e := c.Load(tt.words); e != nil {
+			t.Fatal(e)
+		}
+		err := c.Run(len(tt.words))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("got %v; want %s", err, tt.want)
+		}
+		if c.PC() != uint16(len(tt.words)-1) {
+			t.Errorf("PC should stay at the invalid instruction, but got %d", c.PC())
+		}
+	}
+}
+
+func TestSetRAM(t *testing.T) {
+	c := New()
+	c.SetRAM(0, 1)
+	c.SetRAM(KBD, 2)
+	c.SetRAM(KBD+1, 3)
+	if c.RAM(0) != 1 || c.RAM(KBD) != 2 || c.RAM(KBD+1) != 0 {
+		t.Errorf("got = %d, %d, %d; want = 1, 2, 0", c.RAM(0), c.RAM(KBD), c.RAM(KBD+1))
+	}
+}
+
+func TestLoadHack(t *testing.T) {
+	c := New()
+	if e := c.LoadHack(strings.NewReader("0000000000000111\n\n1110110000010000\n")); e != nil {
+		t.Fatal(e)
+	}
+	if c.ROM(0) != 7 || c.ROM(1) != 0xEC10 || c.ROM(2) != 0 {
+		t.Errorf("got = %04X %04X %04X", c.ROM(0), c.ROM(1), c.ROM(2))
+	}
+
+	loadHackErrorTests := []struct {
+		src  string
+		want string
+	}{
+		{"0000000000000111\n111011000001000", "line 2: invalid instruction: 111011000001000"},
+		{"0000000000000121", "line 1: invalid instruction: 0000000000000121"},
+	}
+	for _, tt := range loadHackErrorTests {
+		if e := c.LoadHack(strings.NewReader(tt.src)); e == nil || e.Error() != tt.want {
+			t.Errorf("got %v; want %s", e, tt.want)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	loadFileTests := []struct {
+		file       string
+		r0, r1     uint16
+		addr, want uint16
+		cycles     int
+	}{
+		{"../../projects/06/add/Add.asm", 0, 0, 0, 5, 6},
+		{"../../projects/06/max/Max.hack", 3, 9, 2, 9, 100},
+		{"../../projects/04/mult/Mult.hack", 6, 7, 2, 42, 1000},
+	}
+
+	for _, tt := range loadFileTests {
+		c := New()
+		if _, err := c.LoadFile(tt.file, asm.Options{}); err != nil {
+			t.Fatal(err)
+		}
+		c.SetRAM(0, tt.r0)
+		c.SetRAM(1, tt.r1)
+		if e := c.Run(tt.cycles); e != nil {
+			t.Fatalf("%s: %s", tt.file, e.Error())
+		}
+		if got := c.RAM(tt.addr); got != tt.want {
+			t.Errorf("%s: RAM[%d]: got = %d; want = %d", tt.file, tt.addr, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	c := New()
+	if _, err := c.LoadFile("../../projects/06/pong/Pong.hack", asm.Options{}); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Reset()
+		if e := c.Run(100000); e != nil {
+			b.Fatal(e)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/skatsuta/nand2tetris/assembler/asm"
+)
+
+// bitLen is the number of bits in a word.
+const bitLen = 16
+
+// LoadHack loads a program in the .hack format, which has 16 binary digits per line, into ROM.
+// Empty lines are skipped.
+func (c *CPU) LoadHack(r io.Reader) error {
+	var (
+		words  []uint16
+		lineno int
+	)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		lineno++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(text, 2, bitLen)
+		if err != nil || len(text) != bitLen {
+			return fmt.Errorf("line %d: invalid instruction: %s", lineno, text)
+		}
+		words = append(words, uint16(v))
+	}
+	if e := sc.Err(); e != nil {
+		return fmt.Errorf("failed to read input: %s", e.Error())
+	}
+	return c.Load(words)
+}
+
+// LoadAsm assembles the Hack assembly program read from r with opts, and loads it into ROM.
+// The returned program has the symbol table and the source positions of the words.
+func (c *CPU) LoadAsm(r io.Reader, opts asm.Options) (*asm.Program, error) {
+	prog, err := asm.Assemble(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	if e := c.Load(prog.Words); e != nil {
+		return nil, e
+	}
+	return prog, nil
+}
+
+// LoadFile loads the program in the file name into ROM. A file with the .asm extension
+// is assembled with opts, in which FileName is set to name, and the program is returned.
+// Any other file is read in the .hack format, and the returned program is nil.
+func (c *CPU) LoadFile(name string, opts asm.Options) (*asm.Program, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if filepath.Ext(name) == ".asm" {
+		opts.FileName = name
+		return c.LoadAsm(file, opts)
+	}
+	if e := c.LoadHack(file); e != nil {
+		return nil, fmt.Errorf("%s: %s", name, e.Error())
+	}
+	return nil, nil
+}
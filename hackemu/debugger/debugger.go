@@ -0,0 +1,469 @@
+// Package debugger implements a debugger of Hack machine code running on the emulator.
+// It is driven by a line-oriented command protocol, so it can be scripted in tests.
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/skatsuta/nand2tetris/assembler/disasm"
+	"github.com/skatsuta/nand2tetris/assembler/symbtbl"
+	"github.com/skatsuta/nand2tetris/hackemu/cpu"
+)
+
+// ErrQuit is returned by Exec when the quit command is executed.
+var ErrQuit = errors.New("quit")
+
+const (
+	// defaultLimit is the default maximum number of instructions executed by continue and next.
+	defaultLimit = 10000000
+	// listLen is the default number of instructions shown by list.
+	listLen = 5
+
+	// addrSP is the RAM address of SP.
+	addrSP = 0
+	// retOffset is the offset below SP of the return address pushed by a VM call sequence,
+	// which is followed by LCL, ARG, THIS and THAT.
+	retOffset = 5
+)
+
+// command is a debugger command.
+type command struct {
+	name  string
+	alias string
+	args  string
+	help  string
+	fn    func(d *Debugger, args []string) error
+}
+
+// commands is a list of debugger commands. It is initialized in init
+// because the help command refers to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"break", "b", "LOC", "set a breakpoint at a ROM address or a label", (*Debugger).breakCmd},
+		{"delete", "d", "[LOC]", "delete the breakpoint at LOC, or all breakpoints", (*Debugger).deleteCmd},
+		{"watch", "w", "LOC", "stop when the RAM cell at an address or a symbol such as SP changes", (*Debugger).watchCmd},
+		{"unwatch", "", "[LOC]", "delete the watchpoint at LOC, or all watchpoints", (*Debugger).unwatchCmd},
+		{"step", "s", "[N]", "execute N instructions (default 1)", (*Debugger).stepCmd},
+		{"next", "n", "", "execute one instruction, or a whole VM function call", (*Debugger).nextCmd},
+		{"continue", "c", "", "execute until a breakpoint or a watchpoint is hit", (*Debugger).continueCmd},
+		{"regs", "r", "", "show the registers", (*Debugger).regsCmd},
+		{"print", "p", "LOC [N]", "show N RAM cells from LOC (default 1)", (*Debugger).printCmd},
+		{"set", "", "A|D|PC|LOC VALUE", "set a register or a RAM cell", (*Debugger).setCmd},
+		{"list", "l", "[LOC] [N]", "show N instructions from LOC (default PC)", (*Debugger).listCmd},
+		{"reset", "", "", "set PC to 0", (*Debugger).resetCmd},
+		{"help", "h", "", "show this help", (*Debugger).helpCmd},
+		{"quit", "q", "", "quit the debugger", (*Debugger).quitCmd},
+	}
+}
+
+// lookupCommand returns the command named name or its alias.
+func lookupCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if name == cmd.name || name == cmd.alias {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// Debugger is a debugger of a program loaded into a Hack computer.
+// Debugger is not thread safe, so it should not be used in multiple goroutines.
+type Debugger struct {
+	c       *cpu.CPU
+	out     io.Writer
+	prompt  string
+	limit   uint64
+	symbs   *symbols
+	dis     *disasm.Disasm
+	breaks  map[uint16]bool
+	watches map[uint16]uint16 // last values of the watched RAM cells
+}
+
+// New creates a new Debugger that debugs c and writes its output into out.
+func New(c *cpu.CPU, out io.Writer) *Debugger {
+	dis := disasm.New(strings.NewReader(""))
+	// the emulator executes the extended instructions as well
+	dis.SetExtended(true)
+	return &Debugger{
+		c:       c,
+		out:     out,
+		limit:   defaultLimit,
+		symbs:   newSymbols(nil),
+		dis:     dis,
+		breaks:  map[uint16]bool{},
+		watches: map[uint16]uint16{},
+	}
+}
+
+// SetSymbols sets the symbol table of the program, whose labels and variables are used
+// as locations in commands and shown in the output.
+func (d *Debugger) SetSymbols(st *symbtbl.SymbolTable) {
+	d.symbs = newSymbols(st)
+}
+
+// SetPrompt sets the prompt written before reading each command in Run.
+// By default, no prompt is written.
+func (d *Debugger) SetPrompt(prompt string) {
+	d.prompt = prompt
+}
+
+// SetLimit sets the maximum number of instructions executed by a continue or next command,
+// which stops a program in an infinite loop.
+func (d *Debugger) SetLimit(n uint64) {
+	d.limit = n
+}
+
+// Run reads commands from in line by line and executes them until the end of input
+// or a quit command. Empty lines and lines starting with # are skipped.
+// An error of a command is written into the output, and Run goes on to the next command.
+func (d *Debugger) Run(in io.Reader) error {
+	sc := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(d.out, d.prompt)
+		if !sc.Scan() {
+			break
+		}
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if e := d.Exec(line); e == ErrQuit {
+			return nil
+		} else if e != nil {
+			fmt.Fprintf(d.out, "error: %s\n", e.Error())
+		}
+	}
+	return sc.Err()
+}
+
+// Exec executes a command line. It returns ErrQuit for a quit command.
+func (d *Debugger) Exec(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	cmd, found := lookupCommand(fields[0])
+	if !found {
+		return fmt.Errorf("unknown command %s; type help for a list of commands", fields[0])
+	}
+	return cmd.fn(d, fields[1:])
+}
+
+func (d *Debugger) breakCmd(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: break LOC")
+	}
+	addr, err := d.symbs.addr(args[0], symbtbl.Label)
+	if err != nil {
+		return err
+	}
+	if addr >= cpu.ROMSize {
+		return fmt.Errorf("ROM address %d out of range", addr)
+	}
+	d.breaks[addr] = true
+	d.printf("breakpoint at %s\n", d.symbs.romLoc(addr))
+	return nil
+}
+
+func (d *Debugger) deleteCmd(args []string) error {
+	if len(args) == 0 {
+		d.breaks = map[uint16]bool{}
+		d.printf("deleted all breakpoints\n")
+		return nil
+	}
+	addr, err := d.symbs.addr(args[0], symbtbl.Label)
+	if err != nil {
+		return err
+	}
+	if !d.breaks[addr] {
+		return fmt.Errorf("no breakpoint at %s", d.symbs.romLoc(addr))
+	}
+	delete(d.breaks, addr)
+	d.printf("deleted breakpoint at %s\n", d.symbs.romLoc(addr))
+	return nil
+}
+
+func (d *Debugger) watchCmd(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: watch LOC")
+	}
+	addr, err := d.ramAddr(args[0])
+	if err != nil {
+		return err
+	}
+	d.watches[addr] = d.c.RAM(addr)
+	d.printf("watchpoint at %s\n", d.symbs.ramLoc(addr))
+	return nil
+}
+
+func (d *Debugger) unwatchCmd(args []string) error {
+	if len(args) == 0 {
+		d.watches = map[uint16]uint16{}
+		d.printf("deleted all watchpoints\n")
+		return nil
+	}
+	addr, err := d.ramAddr(args[0])
+	if err != nil {
+		return err
+	}
+	if _, found := d.watches[addr]; !found {
+		return fmt.Errorf("no watchpoint at %s", d.symbs.ramLoc(addr))
+	}
+	delete(d.watches, addr)
+	d.printf("deleted watchpoint at %s\n", d.symbs.ramLoc(addr))
+	return nil
+}
+
+func (d *Debugger) stepCmd(args []string) error {
+	n, err := count(args, 1)
+	if err != nil {
+		return err
+	}
+	_, err = d.run(uint64(n), nil)
+	d.where()
+	return err
+}
+
+func (d *Debugger) nextCmd(args []string) error {
+	if !d.isCall() {
+		return d.stepCmd(nil)
+	}
+
+	// run until the callee returns to the instruction next to the call
+	ret, sp := d.c.PC()+1, d.c.RAM(addrSP)
+	stopped, err := d.run(d.limit, func() bool {
+		return d.c.PC() == ret && d.c.RAM(addrSP) < sp
+	})
+	if err == nil && !stopped {
+		d.printf("stopped after %d instructions\n", d.limit)
+	}
+	d.where()
+	return err
+}
+
+func (d *Debugger) continueCmd(args []string) error {
+	stopped, err := d.run(d.limit, nil)
+	if err == nil && !stopped {
+		d.printf("stopped after %d instructions\n", d.limit)
+	}
+	d.where()
+	return err
+}
+
+func (d *Debugger) regsCmd(args []string) error {
+	m := "-"
+	if a := d.c.A(); a <= cpu.KBD {
+		m = strconv.Itoa(int(int16(d.c.RAM(a))))
+	}
+	pc := strconv.Itoa(int(d.c.PC()))
+	if name := d.symbs.romName(d.c.PC()); name != "" {
+		pc += " (" + name + ")"
+	}
+	d.printf("A=%d D=%d M=%s PC=%s cycles=%d\n", int16(d.c.A()), int16(d.c.D()), m, pc, d.c.Cycles())
+	return nil
+}
+
+func (d *Debugger) printCmd(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage: print LOC [N]")
+	}
+	addr, err := d.ramAddr(args[0])
+	if err != nil {
+		return err
+	}
+	n, err := count(args[1:], 1)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n && int(addr)+i <= cpu.KBD; i++ {
+		a := addr + uint16(i)
+		d.printf("%s = %d\n", d.symbs.ramLoc(a), int16(d.c.RAM(a)))
+	}
+	return nil
+}
+
+func (d *Debugger) setCmd(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: set A|D|PC|LOC VALUE")
+	}
+	v, err := strconv.ParseInt(args[1], 0, 32)
+	if err != nil || v < -0x8000 || v > 0xFFFF {
+		return fmt.Errorf("invalid value: %s", args[1])
+	}
+
+	w := uint16(v)
+	switch args[0] {
+	case "A":
+		d.c.SetA(w)
+	case "D":
+		d.c.SetD(w)
+	case "PC":
+		d.c.SetPC(w)
+	default:
+		addr, err := d.ramAddr(args[0])
+		if err != nil {
+			return err
+		}
+		d.c.SetRAM(addr, w)
+		// a change by the user does not hit the watchpoint
+		if _, found := d.watches[addr]; found {
+			d.watches[addr] = w
+		}
+		d.printf("%s = %d\n", d.symbs.ramLoc(addr), int16(w))
+		return nil
+	}
+	d.printf("%s = %d\n", args[0], int16(w))
+	return nil
+}
+
+func (d *Debugger) listCmd(args []string) error {
+	addr := d.c.PC()
+	if len(args) > 0 {
+		var err error
+		if addr, err = d.symbs.addr(args[0], symbtbl.Label); err != nil {
+			return err
+		}
+		args = args[1:]
+	}
+	n, err := count(args, listLen)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n && int(addr)+i < cpu.ROMSize; i++ {
+		d.list(addr + uint16(i))
+	}
+	return nil
+}
+
+func (d *Debugger) resetCmd(args []string) error {
+	d.c.Reset()
+	d.where()
+	return nil
+}
+
+func (d *Debugger) helpCmd(args []string) error {
+	for _, cmd := range commands {
+		name := cmd.name
+		if cmd.alias != "" {
+			name += ", " + cmd.alias
+		}
+		d.printf("%-24s %s\n", strings.TrimSpace(name+" "+cmd.args), cmd.help)
+	}
+	d.printf("LOC is a decimal or hexadecimal (0x...) address, or a symbol of the program.\n")
+	return nil
+}
+
+func (d *Debugger) quitCmd(args []string) error {
+	return ErrQuit
+}
+
+// run executes up to n instructions until done returns true or a breakpoint or a watchpoint
+// is hit. done can be nil. It reports whether the execution is stopped before n instructions.
+func (d *Debugger) run(n uint64, done func() bool) (bool, error) {
+	for i := uint64(0); i < n; i++ {
+		if e := d.c.Step(); e != nil {
+			return true, e
+		}
+		if done != nil && done() {
+			return true, nil
+		}
+		hit := d.checkWatches()
+		if pc := d.c.PC(); d.breaks[pc] {
+			d.printf("breakpoint at %s\n", d.symbs.romLoc(pc))
+			hit = true
+		}
+		if hit {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkWatches writes the watched RAM cells that have changed, and reports whether any of them has.
+func (d *Debugger) checkWatches() bool {
+	var changed []uint16
+	for addr, old := range d.watches {
+		if d.c.RAM(addr) != old {
+			changed = append(changed, addr)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i] < changed[j] })
+
+	for _, addr := range changed {
+		v := d.c.RAM(addr)
+		d.printf("%s changed from %d to %d\n", d.symbs.ramLoc(addr), int16(d.watches[addr]), int16(v))
+		d.watches[addr] = v
+	}
+	return len(changed) > 0
+}
+
+// isCall reports whether the instruction at PC is the jump of a call sequence generated
+// by the VM translator, below whose SP the return address is pushed.
+func (d *Debugger) isCall() bool {
+	pc := d.c.PC()
+	if inst := d.c.ROM(pc); inst&0x8000 == 0 || inst&0x7 == 0 {
+		return false
+	}
+	sp := d.c.RAM(addrSP)
+	return sp >= retOffset && sp <= cpu.KBD && d.c.RAM(sp-retOffset) == pc+1
+}
+
+// where writes the instruction at PC.
+func (d *Debugger) where() {
+	d.list(d.c.PC())
+}
+
+// list writes the instruction at addr, marked with > if it is at PC
+// and with * if a breakpoint is set at it.
+func (d *Debugger) list(addr uint16) {
+	w := d.c.ROM(addr)
+	inst, err := d.dis.Inst(w)
+	if err != nil {
+		inst = fmt.Sprintf("%016b (invalid)", w)
+	}
+	mark := []byte("  ")
+	if d.breaks[addr] {
+		mark[0] = '*'
+	}
+	if addr == d.c.PC() {
+		mark[1] = '>'
+	}
+	d.printf("%s %s: %s\n", mark, d.symbs.romLoc(addr), inst)
+}
+
+// ramAddr parses a RAM location arg, which is an address or a pre-defined symbol or a variable.
+func (d *Debugger) ramAddr(arg string) (uint16, error) {
+	addr, err := d.symbs.addr(arg, symbtbl.Predefined, symbtbl.Variable)
+	if err != nil {
+		return 0, err
+	}
+	if addr > cpu.KBD {
+		return 0, fmt.Errorf("RAM address %d out of range", addr)
+	}
+	return addr, nil
+}
+
+// printf writes a formatted output.
+func (d *Debugger) printf(format string, args ...interface{}) {
+	fmt.Fprintf(d.out, format, args...)
+}
+
+// count parses an optional count in args, which defaults to def.
+func count(args []string, def int) (int, error) {
+	if len(args) == 0 {
+		return def, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid count: %s", args[0])
+	}
+	return n, nil
+}
@@ -0,0 +1,142 @@
+package debugger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/skatsuta/nand2tetris/assembler/asm"
+	"github.com/skatsuta/nand2tetris/hackemu/cpu"
+)
+
+// testAsm calls INC with a VM call sequence, which pushes the return address
+// followed by LCL, ARG, THIS and THAT. INC returns without restoring them.
+var testAsm = `
+.macro PUSH_D
+   @SP
+   AM=M+1
+   A=A-1
+   M=D
+.endm
+   @256
+   D=A
+   @SP
+   M=D
+   @RET
+   D=A
+   PUSH_D
+   @LCL
+   D=M
+   PUSH_D
+   @ARG
+   D=M
+   PUSH_D
+   @THIS
+   D=M
+   PUSH_D
+   @THAT
+   D=M
+   PUSH_D
+   @INC
+   0;JMP
+(RET)
+   @counter
+   M=M+1
+(END)
+   @END
+   0;JMP
+(INC)
+   @counter
+   M=M+1
+   @5
+   D=A
+   @SP
+   M=M-D
+   A=M
+   A=M
+   0;JMP
+`
+
+// newDebugger assembles testAsm and returns a debugger for it.
+func newDebugger(t *testing.T, out *bytes.Buffer) *Debugger {
+	c := cpu.New()
+	prog, err := c.LoadAsm(strings.NewReader(testAsm), asm.Options{})
+	if err != nil {
+		t.Fatalf("failed to assemble: %s", err.Error())
+	}
+	d := New(c, out)
+	d.SetSymbols(prog.Symbols)
+	d.SetLimit(1000)
+	return d
+}
+
+func TestRun(t *testing.T) {
+	runTests := []struct {
+		script string
+		want   string
+	}{
+		{
+			"break INC\ncontinue\nregs",
+			"breakpoint at ROM[40] (INC)\n" +
+				"breakpoint at ROM[40] (INC)\n" +
+				"*> ROM[40] (INC): @16\n" +
+				"A=40 D=0 M=0 PC=40 (INC) cycles=36\n",
+		},
+		{
+			"watch SP\ncontinue\nprint SP\nunwatch\ncontinue",
+			"watchpoint at RAM[0] (SP)\n" +
+				"RAM[0] (SP) changed from 0 to 256\n" +
+				" > ROM[4]: @36\n" +
+				"RAM[0] (SP) = 256\n" +
+				"deleted all watchpoints\n" +
+				"stopped after 1000 instructions\n" +
+				" > ROM[39] (END+1): 0;JMP\n",
+		},
+		{
+			// next steps over the call of INC
+			"step 35\nnext\nprint counter\nprint SP",
+			" > ROM[35]: 0;JMP\n" +
+				" > ROM[36] (RET): @16\n" +
+				"RAM[16] (counter) = 1\n" +
+				"RAM[0] (SP) = 256\n",
+		},
+		{
+			// a breakpoint in the callee stops next
+			"step 35\nbreak INC+2\nnext\nnext",
+			" > ROM[35]: 0;JMP\n" +
+				"breakpoint at ROM[42] (INC+2)\n" +
+				"breakpoint at ROM[42] (INC+2)\n" +
+				"*> ROM[42] (INC+2): @5\n" +
+				" > ROM[43] (INC+3): D=A\n",
+		},
+		{
+			"step 3\nlist RET 3\nprint 0x10 2",
+			" > ROM[3]: M=D\n" +
+				"   ROM[36] (RET): @16\n" +
+				"   ROM[37] (RET+1): M=M+1\n" +
+				"   ROM[38] (END): @38\n" +
+				"RAM[16] (counter) = 0\n" +
+				"RAM[17] = 0\n",
+		},
+		{
+			"set D -1\nset counter 7\nfoo\nbreak 40000\nwatch LOOP\ndelete 3\nquit\nregs",
+			"D = -1\n" +
+				"RAM[16] (counter) = 7\n" +
+				"error: unknown command foo; type help for a list of commands\n" +
+				"error: ROM address 40000 out of range\n" +
+				"error: LOOP is neither an address nor a predefined or variable\n" +
+				"error: no breakpoint at ROM[3]\n",
+		},
+	}
+
+	for _, tt := range runTests {
+		var out bytes.Buffer
+		d := newDebugger(t, &out)
+		if e := d.Run(strings.NewReader(tt.script)); e != nil {
+			t.Fatalf("Run failed: %s", e.Error())
+		}
+		if out.String() != tt.want {
+			t.Errorf("script %q:\ngot:\n%s\nwant:\n%s", tt.script, out.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package debugger
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/skatsuta/nand2tetris/assembler/symbtbl"
+)
+
+// label is a label symbol at a ROM address.
+type label struct {
+	name string
+	addr uint16
+}
+
+// symbols is a reverse lookup table of symbol names by addresses.
+type symbols struct {
+	st     *symbtbl.SymbolTable
+	labels []label           // labels sorted by address
+	vars   map[uint16]string // names of RAM addresses
+}
+
+// newSymbols creates a reverse lookup table of st. st can be nil.
+func newSymbols(st *symbtbl.SymbolTable) *symbols {
+	s := &symbols{st: st, vars: map[uint16]string{}}
+	if st == nil {
+		return s
+	}
+
+	for _, e := range st.Entries() {
+		addr := uint16(e.Address)
+		switch e.Kind {
+		case symbtbl.Label:
+			// Entries are sorted by address, and by name at the same address
+			if n := len(s.labels); n == 0 || s.labels[n-1].addr != addr {
+				s.labels = append(s.labels, label{name: e.Name, addr: addr})
+			}
+		case symbtbl.Predefined, symbtbl.Variable:
+			// prefer SP, LCL, ... to R0, R1, ...
+			if name, found := s.vars[addr]; !found || isRegName(name) && !isRegName(e.Name) {
+				s.vars[addr] = e.Name
+			}
+		}
+	}
+	return s
+}
+
+// isRegName reports whether name is a virtual register name such as R0 and R15.
+func isRegName(name string) bool {
+	if len(name) < 2 || name[0] != 'R' {
+		return false
+	}
+	_, err := strconv.Atoi(name[1:])
+	return err == nil
+}
+
+// romName returns the nearest label at or before addr with the offset, such as LOOP or LOOP+2.
+// It returns "" if no label is found.
+func (s *symbols) romName(addr uint16) string {
+	i := sort.Search(len(s.labels), func(i int) bool {
+		return s.labels[i].addr > addr
+	})
+	if i == 0 {
+		return ""
+	}
+	l := s.labels[i-1]
+	if l.addr == addr {
+		return l.name
+	}
+	return fmt.Sprintf("%s+%d", l.name, addr-l.addr)
+}
+
+// romLoc returns a description of ROM address addr, such as "ROM[12] (LOOP)".
+func (s *symbols) romLoc(addr uint16) string {
+	if name := s.romName(addr); name != "" {
+		return fmt.Sprintf("ROM[%d] (%s)", addr, name)
+	}
+	return fmt.Sprintf("ROM[%d]", addr)
+}
+
+// ramLoc returns a description of RAM address addr, such as "RAM[0] (SP)".
+func (s *symbols) ramLoc(addr uint16) string {
+	if name, found := s.vars[addr]; found {
+		return fmt.Sprintf("RAM[%d] (%s)", addr, name)
+	}
+	return fmt.Sprintf("RAM[%d]", addr)
+}
+
+// addr parses a location arg, which is an address or a symbol of one of kinds
+// optionally followed by an offset, such as LOOP+2.
+func (s *symbols) addr(arg string, kinds ...symbtbl.Kind) (uint16, error) {
+	if v, err := strconv.ParseUint(arg, 0, 16); err == nil {
+		return uint16(v), nil
+	}
+
+	symb, off := arg, uint64(0)
+	if i := strings.LastIndexByte(arg, '+'); i > 0 {
+		v, err := strconv.ParseUint(arg[i+1:], 0, 16)
+		if err != nil {
+			return 0, fmt.Errorf("invalid offset in %s", arg)
+		}
+		symb, off = arg[:i], v
+	}
+	if s.st != nil {
+		if k, found := s.st.Kind(symb); found {
+			for _, kind := range kinds {
+				if k == kind {
+					return uint16(uint64(s.st.GetAddress(symb)) + off), nil
+				}
+			}
+		}
+	}
+
+	names := make([]string, len(kinds))
+	for i, k := range kinds {
+		names[i] = k.String()
+	}
+	return 0, fmt.Errorf("%s is neither an address nor a %s", arg, strings.Join(names, " or "))
+}
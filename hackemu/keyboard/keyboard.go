@@ -0,0 +1,168 @@
+// Package keyboard feeds scripted key presses into the keyboard of the Hack computer,
+// so interactive programs can be run headlessly in tests.
+package keyboard
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/skatsuta/nand2tetris/hackemu/cpu"
+)
+
+// Key codes of the special keys of the Hack keyboard. Printable characters are
+// represented by their ASCII codes.
+const (
+	Newline   = 128
+	Backspace = 129
+	Left      = 130
+	Up        = 131
+	Right     = 132
+	Down      = 133
+	Home      = 134
+	End       = 135
+	PageUp    = 136
+	PageDown  = 137
+	Insert    = 138
+	Delete    = 139
+	Esc       = 140
+	// F1 is the code of F1 key. The codes of F2 to F12 keys follow it.
+	F1 = 141
+)
+
+// names is a map of key names and codes.
+var names = map[string]uint16{
+	"space":     ' ',
+	"newline":   Newline,
+	"enter":     Newline,
+	"backspace": Backspace,
+	"left":      Left,
+	"up":        Up,
+	"right":     Right,
+	"down":      Down,
+	"home":      Home,
+	"end":       End,
+	"pageup":    PageUp,
+	"pagedown":  PageDown,
+	"insert":    Insert,
+	"delete":    Delete,
+	"esc":       Esc,
+}
+
+func init() {
+	for i := 0; i < 12; i++ {
+		names["f"+strconv.Itoa(i+1)] = uint16(F1 + i)
+	}
+}
+
+// Lookup returns the key code of name, which is a key name such as left and f1 in any case,
+// or a printable ASCII character.
+func Lookup(name string) (uint16, bool) {
+	if r, size := utf8.DecodeRuneInString(name); size == len(name) && r > ' ' && r < 0x7F {
+		return uint16(r), true
+	}
+	code, found := names[strings.ToLower(name)]
+	return code, found
+}
+
+// Event is a key press, which holds down the key for Duration instructions from Start.
+type Event struct {
+	Key      uint16
+	Start    uint64 // cycle at which the key is pressed
+	Duration uint64
+}
+
+// Script is a timeline of key presses. If key presses overlap, the one started last is
+// in effect, and if they start at the same cycle, the later one in the script is.
+type Script []Event
+
+// Parse reads a script of key presses from r. Each line has a key name,
+// a start cycle and a duration separated by white spaces, such as "right 1000 5000".
+// Empty lines and lines starting with # are skipped.
+func Parse(r io.Reader) (Script, error) {
+	var (
+		s      Script
+		lineno int
+	)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		lineno++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: want KEY START DURATION, but got %q", lineno, line)
+		}
+		key, found := Lookup(fields[0])
+		if !found {
+			return nil, fmt.Errorf("line %d: unknown key %s", lineno, fields[0])
+		}
+		start, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid start cycle %s", lineno, fields[1])
+		}
+		dur, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil || dur == 0 {
+			return nil, fmt.Errorf("line %d: invalid duration %s", lineno, fields[2])
+		}
+		s = append(s, Event{Key: key, Start: start, Duration: dur})
+	}
+	if e := sc.Err(); e != nil {
+		return nil, fmt.Errorf("failed to read input: %s", e.Error())
+	}
+	return s, nil
+}
+
+// KeyAt returns the code of the key held down at cycle t, or 0 if no key is.
+func (s Script) KeyAt(t uint64) uint16 {
+	var (
+		key   uint16
+		start uint64
+		found bool
+	)
+	for _, e := range s {
+		if e.Start <= t && t-e.Start < e.Duration && (!found || e.Start >= start) {
+			key, start, found = e.Key, e.Start, true
+		}
+	}
+	return key
+}
+
+// next returns the first cycle after t at which a key is pressed or released.
+func (s Script) next(t uint64) uint64 {
+	next := uint64(math.MaxUint64)
+	for _, e := range s {
+		if e.Start > t && e.Start < next {
+			next = e.Start
+		}
+		if end := e.Start + e.Duration; end > t && end < next {
+			next = end
+		}
+	}
+	return next
+}
+
+// Run executes up to n instructions of c, pressing and releasing the keys in s
+// by the cycle count of c. It stops at the first error.
+func (s Script) Run(c *cpu.CPU, n int) error {
+	for n > 0 {
+		now := c.Cycles()
+		c.SetKey(s.KeyAt(now))
+		k := n
+		if d := s.next(now) - now; d < uint64(k) {
+			k = int(d)
+		}
+		if e := c.Run(k); e != nil {
+			return e
+		}
+		n -= k
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package keyboard
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/skatsuta/nand2tetris/assembler/asm"
+	"github.com/skatsuta/nand2tetris/hackemu/cpu"
+)
+
+func TestLookup(t *testing.T) {
+	lookupTests := []struct {
+		name  string
+		code  uint16
+		found bool
+	}{
+		{"A", 'A', true},
+		{"a", 'a', true},
+		{"1", '1', true},
+		{"space", ' ', true},
+		{"newline", 128, true},
+		{"Enter", 128, true},
+		{"LEFT", 130, true},
+		{"down", 133, true},
+		{"esc", 140, true},
+		{"f1", 141, true},
+		{"F12", 152, true},
+		{"f13", 0, false},
+		{"ab", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range lookupTests {
+		code, found := Lookup(tt.name)
+		if code != tt.code || found != tt.found {
+			t.Errorf("Lookup(%q): got = (%d, %v); want = (%d, %v)", tt.name, code, found, tt.code, tt.found)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	src := "# move the bat\nright 1000 5000\n\n  left 7000 10\nq 9000 1\n"
+	want := Script{{Right, 1000, 5000}, {Left, 7000, 10}, {'q', 9000, 1}}
+
+	got, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v; want: %v", got, want)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	parseErrorTests := []struct {
+		src  string
+		want string
+	}{
+		{"right 1000", `line 1: want KEY START DURATION, but got "right 1000"`},
+		{"\nkey 0 1", "line 2: unknown key key"},
+		{"A -1 1", "line 1: invalid start cycle -1"},
+		{"A 0 0", "line 1: invalid duration 0"},
+	}
+
+	for _, tt := range parseErrorTests {
+		if _, err := Parse(strings.NewReader(tt.src)); err == nil || err.Error() != tt.want {
+			t.Errorf("got %v; want %s", err, tt.want)
+		}
+	}
+}
+
+func TestKeyAt(t *testing.T) {
+	s := Script{{'A', 10, 10}, {'B', 15, 2}, {'C', 15, 1}}
+	keyAtTests := []struct {
+		t    uint64
+		want uint16
+	}{
+		{9, 0},
+		{10, 'A'},
+		{15, 'C'},
+		{16, 'B'},
+		{17, 'A'},
+		{19, 'A'},
+		{20, 0},
+	}
+
+	for _, tt := range keyAtTests {
+		if got := s.KeyAt(tt.t); got != tt.want {
+			t.Errorf("KeyAt(%d): got = %d; want = %d", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	// count up RAM[16] while any key is pressed
+	src := "(LOOP)\n@KBD\nD=M\n@LOOP\nD;JEQ\n@n\nM=M+1\n@LOOP\n0;JMP"
+	c := cpu.New()
+	if _, err := c.LoadAsm(strings.NewReader(src), asm.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the key is seen by 2 loops of 8 instructions
+	s := Script{{Down, 100, 16}}
+	if e := s.Run(c, 1000); e != nil {
+		t.Fatal(e)
+	}
+	if got := c.RAM(16); got != 2 {
+		t.Errorf("RAM[16]: got = %d; want = 2", got)
+	}
+	if c.RAM(cpu.KBD) != 0 || c.Cycles() != 1000 {
+		t.Errorf("got KBD = %d, cycles = %d; want KBD = 0, cycles = 1000", c.RAM(cpu.KBD), c.Cycles())
+	}
+}
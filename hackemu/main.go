@@ -0,0 +1,211 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/skatsuta/nand2tetris/assembler/asm"
+	"github.com/skatsuta/nand2tetris/assembler/parser"
+	"github.com/skatsuta/nand2tetris/assembler/symbtbl"
+	"github.com/skatsuta/nand2tetris/hackemu/cpu"
+	"github.com/skatsuta/nand2tetris/hackemu/debugger"
+	"github.com/skatsuta/nand2tetris/hackemu/keyboard"
+	"github.com/skatsuta/nand2tetris/hackemu/screen"
+	"github.com/skatsuta/nand2tetris/hackemu/tst"
+)
+
+var (
+	appName = "hackemu"
+	usage   = "Usage: %s [-ext] [-x script] [-limit n] [-run n [-keys file] [-screen file]] file.asm|file.hack|file.tst"
+)
+
+var (
+	// extended enables the shift instructions in the extended instruction set in .asm files.
+	extended = flag.Bool("ext", false, "assemble the shift instructions (e.g. D=D<<) in the extended instruction set")
+	// script is a file of debugger commands.
+	script = flag.String("x", "", "read debugger commands from `file` instead of the standard input")
+	// limit is the maximum number of instructions executed by a command.
+	limit = flag.Uint64("limit", 10000000, "stop continue and next commands after `n` instructions")
+	// run is the number of instructions executed without the debugger.
+	run = flag.Int("run", 0, "run `n` instructions without the debugger")
+	// keys is a file of key presses during -run.
+	keys = flag.String("keys", "", "press keys during -run as scripted in `file`, which has lines of KEY START DURATION")
+	// screenOut is a name of the file into which the screen is written after -run.
+	screenOut = flag.String("screen", "", "write the screen after -run into `file` in PNG (.png), PBM (.pbm) or Unicode block art (others, - for the standard output)")
+)
+
+func init() {
+	flag.Usage = func() {
+		printErr(usage, appName)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	exec := debug
+	switch {
+	case filepath.Ext(args[0]) == ".tst":
+		exec = runScript
+	case *run > 0:
+		exec = headless
+	}
+	if e := exec(args[0]); e != nil {
+		printErr("%s", errMsg(e))
+		os.Exit(1)
+	}
+}
+
+// printErr prints an formatted error message in os.Stderr.
+func printErr(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// load loads the program in path into a new Hack computer, and returns it with the symbol table
+// of the program. The symbol table of a .hack file has only the pre-defined symbols.
+func load(path string) (*cpu.CPU, *symbtbl.SymbolTable, error) {
+	c := cpu.New()
+	prog, err := c.LoadFile(path, asm.Options{Extended: *extended})
+	if err != nil {
+		return nil, nil, err
+	}
+	if prog != nil {
+		return c, prog.Symbols, nil
+	}
+	st := symbtbl.NewSymbolTable()
+	st.AddEntries(asm.PredefinedSymbols)
+	return c, st, nil
+}
+
+// debug loads the program in path and runs the debugger on it.
+func debug(path string) error {
+	c, st, err := load(path)
+	if err != nil {
+		return err
+	}
+
+	d := debugger.New(c, os.Stdout)
+	d.SetLimit(*limit)
+	d.SetSymbols(st)
+
+	var in io.Reader = os.Stdin
+	if *script != "" {
+		file, err := os.Open(*script)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	} else {
+		d.SetPrompt("(" + appName + ") ")
+	}
+	return d.Run(in)
+}
+
+// headless loads the program in path, runs it without the debugger and writes the screen.
+func headless(path string) error {
+	c, _, err := load(path)
+	if err != nil {
+		return err
+	}
+	var script keyboard.Script
+	if *keys != "" {
+		if script, err = readKeys(*keys); err != nil {
+			return err
+		}
+	}
+	if e := script.Run(c, *run); e != nil {
+		return e
+	}
+	if *screenOut == "" {
+		return nil
+	}
+	return writeScreen(screen.New(c.Screen()), *screenOut)
+}
+
+// runScript runs the test script in path, and writes the output file and the echo texts
+// as the CPU emulator of the official tools does.
+func runScript(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	s, err := tst.Parse(file, path)
+	if err != nil {
+		return err
+	}
+	r := tst.New(filepath.Dir(path))
+	r.SetEcho(os.Stdout)
+	r.SetWriteOutput(true)
+	if e := r.Run(s); e != nil {
+		return e
+	}
+	fmt.Println("End of script - Comparison ended successfully")
+	return nil
+}
+
+// readKeys reads a script of key presses from the file name.
+func readKeys(name string) (keyboard.Script, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	script, err := keyboard.Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err.Error())
+	}
+	return script, nil
+}
+
+// writeScreen writes s into the file name in the format of its extension.
+func writeScreen(s *screen.Screen, name string) error {
+	if name == "-" {
+		return s.WriteText(os.Stdout)
+	}
+
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	switch filepath.Ext(name) {
+	case ".png":
+		err = s.WritePNG(file)
+	case ".pbm":
+		err = s.WritePBM(file)
+	default:
+		err = s.WriteText(file)
+	}
+	if e := file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// errMsg returns an error message of err. Each error in a parser.ErrorList is shown in a line.
+func errMsg(err error) string {
+	list, ok := err.(parser.ErrorList)
+	if !ok {
+		return err.Error()
+	}
+
+	msgs := make([]string, len(list))
+	for i, e := range list {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,124 @@
+// Package screen renders the memory map of the Hack screen as an image,
+// so the output of a program can be saved or checked in tests.
+package screen
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/skatsuta/nand2tetris/hackemu/cpu"
+)
+
+const (
+	// Width is the number of pixels in a row of the screen.
+	Width = 512
+	// Height is the number of rows of the screen.
+	Height = 256
+	// wordsPerRow is the number of words in a row of the screen.
+	wordsPerRow = Width / 16
+)
+
+// palette is the colors of the screen: 0 is white and 1 is black.
+var palette = color.Palette{color.Gray{Y: 0xFF}, color.Gray{Y: 0}}
+
+// quadrants is a list of the Unicode block elements for 2x2 pixels, indexed by the bits
+// of the upper left, upper right, lower left and lower right pixels from the lowest.
+var quadrants = []rune(" ▘▝▀▖▌▞▛▗▚▐▜▄▙▟█")
+
+// Screen is a snapshot of the Hack screen. It implements image.Image.
+type Screen struct {
+	words [cpu.ScreenSize]uint16
+}
+
+// New creates a new Screen from words of the memory map of the screen, such as (*cpu.CPU).Screen().
+// The words are copied, so later changes of them do not affect the Screen.
+func New(words []uint16) *Screen {
+	s := &Screen{}
+	copy(s.words[:], words)
+	return s
+}
+
+// Pixel reports whether the pixel at (x, y) is black. The origin is the top left corner,
+// and the leftmost pixel of each word is its least significant bit.
+func (s *Screen) Pixel(x, y int) bool {
+	if x < 0 || x >= Width || y < 0 || y >= Height {
+		return false
+	}
+	return s.words[y*wordsPerRow+x/16]>>uint(x%16)&1 != 0
+}
+
+// ColorModel implements image.Image.
+func (s *Screen) ColorModel() color.Model {
+	return palette
+}
+
+// Bounds implements image.Image.
+func (s *Screen) Bounds() image.Rectangle {
+	return image.Rect(0, 0, Width, Height)
+}
+
+// At implements image.Image.
+func (s *Screen) At(x, y int) color.Color {
+	if s.Pixel(x, y) {
+		return palette[1]
+	}
+	return palette[0]
+}
+
+// WritePNG writes s into w as a black and white PNG image.
+func (s *Screen) WritePNG(w io.Writer) error {
+	img := image.NewPaletted(s.Bounds(), palette)
+	for y := 0; y < Height; y++ {
+		for x := 0; x < Width; x++ {
+			if s.Pixel(x, y) {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// WritePBM writes s into w as a binary PBM (P4) image, in which 1 is black.
+func (s *Screen) WritePBM(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "P4\n%d %d\n", Width, Height)
+	for _, wd := range s.words {
+		// PBM has the leftmost pixel in the most significant bit of each byte
+		for i := uint(0); i < 2; i++ {
+			var b byte
+			for bit := uint(0); bit < 8; bit++ {
+				if wd>>(i*8+bit)&1 != 0 {
+					b |= 0x80 >> bit
+				}
+			}
+			bw.WriteByte(b)
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteText writes s into w as Unicode block art, in which a character has 2x2 pixels,
+// so the screen fits in 256 columns and 128 lines. Trailing spaces in each line are trimmed.
+func (s *Screen) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	line := make([]rune, Width/2)
+	for y := 0; y < Height; y += 2 {
+		for x := 0; x < Width; x += 2 {
+			var q int
+			for i, p := range [...]bool{s.Pixel(x, y), s.Pixel(x+1, y), s.Pixel(x, y+1), s.Pixel(x+1, y+1)} {
+				if p {
+					q |= 1 << uint(i)
+				}
+			}
+			line[x/2] = quadrants[q]
+		}
+		bw.WriteString(strings.TrimRight(string(line), " "))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
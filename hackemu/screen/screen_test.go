@@ -0,0 +1,147 @@
+package screen
+
+import (
+	"bytes"
+	"image/png"
+	"io/ioutil"
+	"testing"
+
+	"github.com/skatsuta/nand2tetris/assembler/asm"
+	"github.com/skatsuta/nand2tetris/hackemu/cpu"
+)
+
+// testScreen returns a screen with the leftmost and the rightmost pixels of the first row
+// and the pixel at (17, 1).
+func testScreen() *Screen {
+	words := make([]uint16, cpu.ScreenSize)
+	words[0] = 0x1
+	words[wordsPerRow-1] = 0x8000
+	words[wordsPerRow+1] = 0x2
+	return New(words)
+}
+
+func TestPixel(t *testing.T) {
+	pixelTests := []struct {
+		x, y int
+		want bool
+	}{
+		{0, 0, true},
+		{1, 0, false},
+		{511, 0, true},
+		{17, 1, true},
+		{16, 1, false},
+		{-1, 0, false},
+		{0, 256, false},
+	}
+
+	s := testScreen()
+	for _, tt := range pixelTests {
+		if got := s.Pixel(tt.x, tt.y); got != tt.want {
+			t.Errorf("Pixel(%d, %d): got = %v; want = %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestWritePBM(t *testing.T) {
+	var buf bytes.Buffer
+	if e := testScreen().WritePBM(&buf); e != nil {
+		t.Fatal(e)
+	}
+
+	header := "P4\n512 256\n"
+	got := buf.Bytes()
+	if len(got) != len(header)+Width*Height/8 || string(got[:len(header)]) != header {
+		t.Fatalf("invalid PBM header or size: %q, %d bytes", got[:len(header)], len(got))
+	}
+	data := got[len(header):]
+	// the first row starts with 1000 0000 and ends with 0000 0001
+	if data[0] != 0x80 || data[1] != 0 || data[Width/8-1] != 0x01 {
+		t.Errorf("first row: got = %08b ... %08b", data[:2], data[Width/8-1])
+	}
+	// (17, 1) is the second bit of the third byte in the second row
+	if data[Width/8+2] != 0x40 {
+		t.Errorf("second row: got = %08b; want = 01000000", data[Width/8+2])
+	}
+}
+
+func TestWritePNG(t *testing.T) {
+	s := testScreen()
+	var buf bytes.Buffer
+	if e := s.WritePNG(&buf); e != nil {
+		t.Fatal(e)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != s.Bounds() {
+		t.Fatalf("bounds: got = %v; want = %v", img.Bounds(), s.Bounds())
+	}
+	for y := 0; y < Height; y++ {
+		for x := 0; x < Width; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+			if black := r == 0; black != s.Pixel(x, y) {
+				t.Fatalf("pixel (%d, %d): got black = %v; want = %v", x, y, black, s.Pixel(x, y))
+			}
+		}
+	}
+}
+
+// run loads the program in file, sets RAM[0] to r0 and runs it for n instructions.
+func run(t *testing.T, file string, r0 uint16, n int) *cpu.CPU {
+	c := cpu.New()
+	if _, err := c.LoadFile(file, asm.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	c.SetRAM(0, r0)
+	if e := c.Run(n); e != nil {
+		t.Fatal(e)
+	}
+	return c
+}
+
+func TestGolden(t *testing.T) {
+	goldenTests := []struct {
+		file   string
+		r0     uint16
+		cycles int
+		golden string
+	}{
+		{"../../projects/06/rect/Rect.hack", 5, 1000, "testdata/rect.txt"},
+		{"../../projects/06/pong/Pong.hack", 0, 10000000, "testdata/pong.txt"},
+	}
+
+	for _, tt := range goldenTests {
+		c := run(t, tt.file, tt.r0, tt.cycles)
+		var got bytes.Buffer
+		if e := New(c.Screen()).WriteText(&got); e != nil {
+			t.Fatal(e)
+		}
+		want, err := ioutil.ReadFile(tt.golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want) {
+			t.Errorf("%s: the screen differs from %s:\n%s", tt.file, tt.golden, got.String())
+		}
+	}
+}
+
+func TestFill(t *testing.T) {
+	c := run(t, "../../projects/04/fill/Fill.hack", 0, 0)
+
+	// a key press blackens the whole screen
+	c.SetKey('A')
+	if e := c.Run(1000000); e != nil {
+		t.Fatal(e)
+	}
+	s := New(c.Screen())
+	for y := 0; y < Height; y++ {
+		for x := 0; x < Width; x++ {
+			if !s.Pixel(x, y) {
+				t.Fatalf("pixel (%d, %d) should be black", x, y)
+			}
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package tst
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// command is a command in a test script.
+type command struct {
+	line  int      // line number in the script
+	name  string   // command name such as set and repeat
+	args  []string // arguments of the command
+	count int      // number of iterations of repeat
+	body  []*command
+}
+
+// Script is a parsed test script of the CPU emulator.
+type Script struct {
+	name string
+	cmds []*command
+}
+
+// token is a token of a test script.
+type token struct {
+	text string
+	line int
+}
+
+// Parse parses a test script read from r. name is the name of the script used in errors.
+func Parse(r io.Reader, name string) (*Script, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %s", name, err.Error())
+	}
+	toks, err := tokenize(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", name, err.Error())
+	}
+
+	p := &scriptParser{toks: toks}
+	cmds, err := p.commands(false)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", name, err.Error())
+	}
+	return &Script{name: name, cmds: cmds}, nil
+}
+
+// tokenize splits src into tokens. Comments are removed, and a quoted string is a token
+// including the quotes.
+func tokenize(src string) ([]token, error) {
+	var toks []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case unicode.IsSpace(rune(c)):
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("%d: unterminated comment", line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case strings.IndexByte(",;!{}", c) >= 0:
+			toks = append(toks, token{text: string(c), line: line})
+			i++
+		case c == '"':
+			end := strings.IndexAny(src[i+1:], "\"\n")
+			if end < 0 || src[i+1+end] != '"' {
+				return nil, fmt.Errorf("%d: unterminated string", line)
+			}
+			toks = append(toks, token{text: src[i : i+end+2], line: line})
+			i += end + 2
+		default:
+			start := i
+			for i < len(src) && !unicode.IsSpace(rune(src[i])) && strings.IndexByte(",;!{}\"", src[i]) < 0 &&
+				!strings.HasPrefix(src[i:], "//") && !strings.HasPrefix(src[i:], "/*") {
+				i++
+			}
+			toks = append(toks, token{text: src[start:i], line: line})
+		}
+	}
+	return toks, nil
+}
+
+// scriptParser is a parser of the tokens of a test script.
+type scriptParser struct {
+	toks []token
+	pos  int
+}
+
+// isTerm reports whether s terminates a command.
+func isTerm(s string) bool {
+	return s == "," || s == ";" || s == "!"
+}
+
+// commands parses commands until the end of the script, a '!', or a '}' if inBlock is true.
+func (p *scriptParser) commands(inBlock bool) ([]*command, error) {
+	var cmds []*command
+	for p.pos < len(p.toks) {
+		tok := p.toks[p.pos]
+		switch {
+		case tok.text == "}":
+			if !inBlock {
+				return nil, fmt.Errorf("%d: unexpected }", tok.line)
+			}
+			p.pos++
+			return cmds, nil
+		case tok.text == "!":
+			if inBlock {
+				return nil, fmt.Errorf("%d: unexpected ! in a block", tok.line)
+			}
+			return cmds, nil
+		case isTerm(tok.text):
+			// an empty command
+			p.pos++
+			continue
+		}
+
+		cmd, err := p.command()
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+	if inBlock {
+		return nil, fmt.Errorf("%d: missing }", p.toks[len(p.toks)-1].line)
+	}
+	return cmds, nil
+}
+
+// command parses a command.
+func (p *scriptParser) command() (*command, error) {
+	tok := p.toks[p.pos]
+	p.pos++
+	cmd := &command{line: tok.line, name: tok.text}
+
+	if cmd.name == "repeat" || cmd.name == "while" {
+		for p.pos < len(p.toks) && p.toks[p.pos].text != "{" {
+			if t := p.toks[p.pos].text; isTerm(t) || t == "}" {
+				return nil, fmt.Errorf("%d: missing { after %s", tok.line, cmd.name)
+			}
+			cmd.args = append(cmd.args, p.toks[p.pos].text)
+			p.pos++
+		}
+		if p.pos == len(p.toks) {
+			return nil, fmt.Errorf("%d: missing { after %s", tok.line, cmd.name)
+		}
+		p.pos++
+
+		if err := cmd.checkLoop(); err != nil {
+			return nil, err
+		}
+		body, err := p.commands(true)
+		if err != nil {
+			return nil, err
+		}
+		cmd.body = body
+		return cmd, nil
+	}
+
+	for p.pos < len(p.toks) {
+		t := p.toks[p.pos].text
+		if isTerm(t) || t == "{" || t == "}" {
+			break
+		}
+		cmd.args = append(cmd.args, t)
+		p.pos++
+	}
+	if p.pos == len(p.toks) || !isTerm(p.toks[p.pos].text) {
+		return nil, fmt.Errorf("%d: missing , or ; after %s", tok.line, cmd.name)
+	}
+	if p.toks[p.pos].text != "!" {
+		p.pos++
+	}
+	return cmd, cmd.check()
+}
+
+// checkLoop checks the arguments of a repeat or while command.
+func (cmd *command) checkLoop() error {
+	if cmd.name == "while" {
+		if len(cmd.args) != 3 {
+			return fmt.Errorf("%d: while needs a condition such as RAM[0] <> 0", cmd.line)
+		}
+		if _, found := conds[cmd.args[1]]; !found {
+			return fmt.Errorf("%d: unknown comparison operator %s", cmd.line, cmd.args[1])
+		}
+		return nil
+	}
+
+	if len(cmd.args) == 0 {
+		// the official tools repeat forever, which never finishes without a user
+		return fmt.Errorf("%d: repeat without the number of iterations, which repeats forever, is not supported", cmd.line)
+	}
+	if len(cmd.args) != 1 {
+		return fmt.Errorf("%d: repeat needs the number of iterations", cmd.line)
+	}
+	n, err := strconv.Atoi(cmd.args[0])
+	if err != nil || n < 0 {
+		return fmt.Errorf("%d: invalid number of iterations: %s", cmd.line, cmd.args[0])
+	}
+	cmd.count = n
+	return nil
+}
+
+// nargs is a map of the commands other than repeat and while, and their numbers of arguments.
+// -1 means any number of arguments.
+var nargs = map[string]int{
+	"load":        1,
+	"output-file": 1,
+	"compare-to":  1,
+	"output-list": -1,
+	"set":         2,
+	"ticktock":    0,
+	"output":      0,
+	"echo":        1,
+	"clear-echo":  0,
+}
+
+// check checks the name and the number of arguments of cmd.
+func (cmd *command) check() error {
+	n, found := nargs[cmd.name]
+	if !found {
+		return fmt.Errorf("%d: unknown command %s", cmd.line, cmd.name)
+	}
+	if n >= 0 && len(cmd.args) != n {
+		return fmt.Errorf("%d: wrong number of arguments to %s: want %d, got %d", cmd.line, cmd.name, n, len(cmd.args))
+	}
+	if cmd.name == "echo" {
+		cmd.args[0] = strings.Trim(cmd.args[0], `"`)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+// Package tst runs the test scripts (.tst) of the CPU emulator of the official tools,
+// and compares their outputs with the compare files (.cmp).
+//
+// The supported commands are load, output-file, compare-to, output-list, set, repeat, while,
+// ticktock, output, echo and clear-echo. The variables are A, D, PC, RAM[n], ROM[n] and time.
+package tst
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/skatsuta/nand2tetris/assembler/asm"
+	"github.com/skatsuta/nand2tetris/hackemu/cpu"
+	"github.com/skatsuta/nand2tetris/textcmp/table"
+)
+
+// CompareError is an error that an output line differs from the line in the compare file.
+// Its message shows the differing columns aligned with the header.
+type CompareError struct {
+	table.Diff
+}
+
+func (e *CompareError) Error() string {
+	return "comparison failure at " + e.Diff.String()
+}
+
+// Runner runs test scripts on a Hack computer.
+// Runner is not thread safe, so it should not be used in multiple goroutines.
+type Runner struct {
+	dir     string
+	c       *cpu.CPU
+	echo    io.Writer
+	write   bool
+	outName string
+	out     []string
+	cmp     []string
+	cols    []column
+}
+
+// New creates a new Runner, which reads and writes the files in a script relative to dir.
+func New(dir string) *Runner {
+	return &Runner{
+		dir:  dir,
+		c:    cpu.New(),
+		echo: ioutil.Discard,
+	}
+}
+
+// SetEcho sets the writer into which the texts of echo commands are written.
+// By default, they are discarded.
+func (r *Runner) SetEcho(w io.Writer) {
+	r.echo = w
+}
+
+// SetWriteOutput sets whether r writes the output into the file given by output-file,
+// as the CPU emulator does. By default, the output is only kept in memory.
+func (r *Runner) SetWriteOutput(write bool) {
+	r.write = write
+}
+
+// CPU returns the Hack computer on which r runs scripts.
+func (r *Runner) CPU() *cpu.CPU {
+	return r.c
+}
+
+// Output returns the lines written by output-list and output commands so far.
+func (r *Runner) Output() []string {
+	return r.out
+}
+
+// RunFile parses and runs the test script in the file path. The files in the script are
+// relative to the directory of path, and no output file is written.
+func RunFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	s, err := Parse(file, path)
+	if err != nil {
+		return err
+	}
+	return New(filepath.Dir(path)).Run(s)
+}
+
+// Run runs script s. It stops at the first output line that differs from the compare file,
+// where a cell of *s matches any value, and returns a *CompareError. If r writes the output, the output file is written
+// even if an error is found.
+func (r *Runner) Run(s *Script) error {
+	err := r.exec(s, s.cmds)
+	if r.write && r.outName != "" {
+		if e := r.writeOutput(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// exec executes cmds in script s.
+func (r *Runner) exec(s *Script, cmds []*command) error {
+	for _, cmd := range cmds {
+		if err := r.execCmd(s, cmd); err != nil {
+			if _, ok := err.(*CompareError); ok {
+				return err
+			}
+			if _, ok := err.(*scriptError); ok {
+				return err
+			}
+			return &scriptError{file: s.name, line: cmd.line, err: err}
+		}
+	}
+	return nil
+}
+
+// execCmd executes cmd in script s.
+func (r *Runner) execCmd(s *Script, cmd *command) error {
+	switch cmd.name {
+	case "load":
+		_, err := r.c.LoadFile(r.path(cmd.args[0]), asm.Options{})
+		return err
+	case "output-file":
+		r.outName = cmd.args[0]
+	case "compare-to":
+		lines, err := readLines(r.path(cmd.args[0]))
+		if err != nil {
+			return err
+		}
+		r.cmp = lines
+	case "output-list":
+		cols := make([]column, len(cmd.args))
+		for i, arg := range cmd.args {
+			col, err := parseColumn(arg)
+			if err != nil {
+				return err
+			}
+			cols[i] = col
+		}
+		r.cols = cols
+		return r.output(header(cols))
+	case "set":
+		v, err := parseVar(cmd.args[0])
+		if err != nil {
+			return err
+		}
+		val, err := parseValue(cmd.args[1])
+		if err != nil {
+			return err
+		}
+		return v.set(r.c, val)
+	case "repeat":
+		for i := 0; i < cmd.count; i++ {
+			if e := r.exec(s, cmd.body); e != nil {
+				return e
+			}
+		}
+	case "while":
+		for {
+			ok, err := r.cond(cmd.args)
+			if err != nil || !ok {
+				return err
+			}
+			if e := r.exec(s, cmd.body); e != nil {
+				return e
+			}
+		}
+	case "ticktock":
+		return r.c.Step()
+	case "output":
+		if r.cols == nil {
+			return fmt.Errorf("output before output-list")
+		}
+		return r.output(row(r.c, r.cols))
+	case "echo":
+		fmt.Fprintln(r.echo, cmd.args[0])
+	case "clear-echo":
+	}
+	return nil
+}
+
+// output writes line into the output, and compares it with the compare file.
+func (r *Runner) output(line string) error {
+	r.out = append(r.out, line)
+	if r.cmp == nil {
+		return nil
+	}
+
+	n := len(r.out)
+	var hdr, cmp string
+	if len(r.cmp) > 0 {
+		hdr = r.cmp[0]
+	}
+	if n <= len(r.cmp) {
+		cmp = r.cmp[n-1]
+	}
+	if ok, cols := table.Match(line, cmp); !ok {
+		return &CompareError{table.Diff{Line: n, Header: hdr, Out: line, Cmp: cmp, Cols: cols}}
+	}
+	return nil
+}
+
+// cond evaluates the condition of a while command such as RAM[0] <> 0.
+func (r *Runner) cond(args []string) (bool, error) {
+	v, err := parseVar(args[0])
+	if err != nil {
+		return false, err
+	}
+	val, err := parseValue(args[2])
+	if err != nil {
+		return false, err
+	}
+	return conds[args[1]](v.get(r.c), val), nil
+}
+
+// path returns the path of the file name in a script.
+func (r *Runner) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(r.dir, name)
+}
+
+// writeOutput writes the output into the output file.
+func (r *Runner) writeOutput() error {
+	var b strings.Builder
+	for _, line := range r.out {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return ioutil.WriteFile(r.path(r.outName), []byte(b.String()), 0644)
+}
+
+// scriptError is an error found in executing a command in a script.
+type scriptError struct {
+	file string
+	line int
+	err  error
+}
+
+func (e *scriptError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.file, e.line, e.err.Error())
+}
+
+// readLines reads the lines of the file path.
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines := []string{}
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	return lines, sc.Err()
+}
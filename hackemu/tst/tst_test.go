@@ -0,0 +1,262 @@
+package tst
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skatsuta/nand2tetris/hackemu/cpu"
+)
+
+func TestParse(t *testing.T) {
+	src := `// a comment
+load Add.hack,
+output-list RAM[0]%D2.6.2 A;
+/* a block
+   comment */
+set RAM[0] %X10,
+repeat 3 {
+  ticktock;
+}
+while RAM[0] <> 0 { ticktock; }
+echo "Hello, world",
+output;`
+
+	s, err := Parse(strings.NewReader(src), "test.tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		line int
+		name string
+		args []string
+		body int
+	}{
+		{2, "load", []string{"Add.hack"}, 0},
+		{3, "output-list", []string{"RAM[0]%D2.6.2", "A"}, 0},
+		{6, "set", []string{"RAM[0]", "%X10"}, 0},
+		{7, "repeat", []string{"3"}, 1},
+		{10, "while", []string{"RAM[0]", "<>", "0"}, 1},
+		{11, "echo", []string{"Hello, world"}, 0},
+		{12, "output", nil, 0},
+	}
+	if len(s.cmds) != len(want) {
+		t.Fatalf("the number of commands: got = %d; want = %d", len(s.cmds), len(want))
+	}
+	for i, w := range want {
+		cmd := s.cmds[i]
+		if cmd.line != w.line || cmd.name != w.name || strings.Join(cmd.args, " ") != strings.Join(w.args, " ") ||
+			len(cmd.body) != w.body {
+			t.Errorf("command %d: got = %d %s %q (%d); want = %d %s %q (%d)",
+				i, cmd.line, cmd.name, cmd.args, len(cmd.body), w.line, w.name, w.args, w.body)
+		}
+	}
+	if s.cmds[3].count != 3 {
+		t.Errorf("repeat count: got = %d; want = 3", s.cmds[3].count)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	parseErrorTests := []struct {
+		src  string
+		want string
+	}{
+		{"load", "test.tst:1: missing , or ; after load"},
+		{"ticktock;\nfoo;", "test.tst:2: unknown command foo"},
+		{"set RAM[0];", "test.tst:1: wrong number of arguments to set: want 2, got 1"},
+		{"repeat { ticktock; }", "test.tst:1: repeat without the number of iterations, which repeats forever, is not supported"},
+		{"repeat 1 2 { ticktock; }", "test.tst:1: repeat needs the number of iterations"},
+		{"repeat x { ticktock; }", "test.tst:1: invalid number of iterations: x"},
+		{"repeat 2 ticktock;", "test.tst:1: missing { after repeat"},
+		{"repeat 2 {\nticktock;", "test.tst:2: missing }"},
+		{"while A == 0 { ticktock; }", "test.tst:1: unknown comparison operator =="},
+		{"ticktock; }", "test.tst:1: unexpected }"},
+		{"/* comment", "test.tst:1: unterminated comment"},
+		{"echo \"hello;", "test.tst:1: unterminated string"},
+	}
+
+	for _, tt := range parseErrorTests {
+		_, err := Parse(strings.NewReader(tt.src), "test.tst")
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%q: got = %v; want = %s", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	formatTests := []struct {
+		col    string
+		header string
+		row    string
+	}{
+		{"RAM[0]%D2.6.2", "|  RAM[0]  |", "|     -42  |"},
+		{"RAM[256]%D1.6.1", "|RAM[256]|", "|    -42 |"},
+		{"A%X1.4.1", "|  A   |", "| 0123 |"},
+		{"D", "|        D         |", "| 0000000000000101 |"},
+		{"PC%D3.1.3", "|  PC   |", "|   7   |"},
+		{"time%S1.4.1", "| time |", "|    0 |"},
+	}
+
+	c := cpu.New()
+	c.SetRAM(0, 0xFFD6)
+	c.SetRAM(256, 0xFFD6)
+	c.SetA(0x123)
+	c.SetD(5)
+	c.SetPC(7)
+	for _, tt := range formatTests {
+		col, err := parseColumn(tt.col)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := header([]column{col}); got != tt.header {
+			t.Errorf("header of %s: got = %q; want = %q", tt.col, got, tt.header)
+		}
+		if got := row(c, []column{col}); got != tt.row {
+			t.Errorf("row of %s: got = %q; want = %q", tt.col, got, tt.row)
+		}
+	}
+}
+
+// writeFiles writes files into a temporary directory and returns the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if e := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	return dir
+}
+
+// countdown decrements RAM[0] until it becomes 0 and stores the number of iterations in RAM[1].
+const countdown = `@1
+M=0
+(LOOP)
+@0
+D=M
+@END
+D;JEQ
+@0
+M=M-1
+@1
+M=M+1
+@LOOP
+0;JMP
+(END)
+@END
+0;JMP
+`
+
+func TestRun(t *testing.T) {
+	script := `load Countdown.asm,
+output-file Countdown.out,
+compare-to Countdown.cmp,
+output-list RAM[0]%D2.6.2 RAM[1]%D2.6.2;
+set RAM[0] 3;
+while PC <> 13 { ticktock; }
+output;
+echo "done";
+`
+	runTests := []struct {
+		cmp  string
+		line int // line number of a comparison failure, or 0 if it passes
+	}{
+		{"|  RAM[0]  |  RAM[1]  |\n|       0  |       3  |\n", 0},
+		{"| RAM[0] | RAM[1] |\n|   0    |   3   |\n", 0},
+		{"|  RAM[0]  |  RAM[1]  |\n|   ****   |       3  |\n", 0},
+		{"|  RAM[0]  |  RAM[1]  |\n|       0  |       2  |\n", 2},
+		{"|  RAM[0]  |  RAM[2]  |\n", 1},
+	}
+
+	for _, tt := range runTests {
+		dir := writeFiles(t, map[string]string{
+			"Countdown.asm": countdown,
+			"Countdown.tst": script,
+			"Countdown.cmp": tt.cmp,
+		})
+		defer os.RemoveAll(dir)
+
+		err := RunFile(filepath.Join(dir, "Countdown.tst"))
+		if tt.line == 0 {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %s", tt.cmp, err)
+			}
+			continue
+		}
+		ce, ok := err.(*CompareError)
+		if !ok || ce.Line != tt.line || ce.Cmp == "" {
+			t.Errorf("%q: got = %v; want = a comparison failure at line %d", tt.cmp, err, tt.line)
+		}
+	}
+}
+
+func TestRunWriteOutput(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"Countdown.asm": countdown,
+	})
+	defer os.RemoveAll(dir)
+
+	src := `load Countdown.asm, output-file Countdown.out, output-list RAM[1]%D1.6.1;
+set RAM[0] 2, repeat 100 { ticktock; } output;
+echo "done";`
+	s, err := Parse(strings.NewReader(src), "Countdown.tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := New(dir)
+	r.SetWriteOutput(true)
+	var echo strings.Builder
+	r.SetEcho(&echo)
+	if e := r.Run(s); e != nil {
+		t.Fatal(e)
+	}
+
+	want := "| RAM[1] |\n|      2 |\n"
+	got, err := ioutil.ReadFile(filepath.Join(dir, "Countdown.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("output: got = %q; want = %q", got, want)
+	}
+	if echo.String() != "done\n" {
+		t.Errorf("echo: got = %q; want = %q", echo.String(), "done\n")
+	}
+}
+
+func TestRunError(t *testing.T) {
+	runErrorTests := []struct {
+		src  string
+		want string
+	}{
+		{"output;", "test.tst:1: output before output-list"},
+		{"set time 0;", "test.tst:1: time cannot be set"},
+		{"set RAM[32768] 0;", "test.tst:1: invalid address in RAM[32768]"},
+		{"set A 65536;", "test.tst:1: invalid value 65536"},
+		{"output-list B;", "test.tst:1: unknown variable B"},
+		{"output-list A%Y1.2.1;", "test.tst:1: invalid format A%Y1.2.1"},
+		{"set ROM[0] %X8000,\nticktock;", "test.tst:2: ROM[0] (1000000000000000): invalid instruction"},
+	}
+
+	for _, tt := range runErrorTests {
+		s, err := Parse(strings.NewReader(tt.src), "test.tst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := New(".").Run(s); e == nil || e.Error() != tt.want {
+			t.Errorf("%q: got = %v; want = %s", tt.src, e, tt.want)
+		}
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	if e := RunFile("../../projects/04/mult/Mult.tst"); e != nil {
+		t.Error(e)
+	}
+}
@@ -0,0 +1,189 @@
+package tst
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/skatsuta/nand2tetris/hackemu/cpu"
+)
+
+// variable is a variable of the CPU emulator, such as A and RAM[256].
+type variable struct {
+	name string // A, D, PC, time, RAM or ROM
+	addr uint16 // address of RAM or ROM
+}
+
+// parseVar parses s as a variable.
+func parseVar(s string) (variable, error) {
+	switch s {
+	case "A", "D", "PC", "time":
+		return variable{name: s}, nil
+	}
+
+	for _, name := range []string{"RAM", "ROM"} {
+		if !strings.HasPrefix(s, name+"[") || !strings.HasSuffix(s, "]") {
+			continue
+		}
+		addr, err := strconv.ParseUint(s[len(name)+1:len(s)-1], 10, 16)
+		if err != nil || addr >= cpu.RAMSize {
+			return variable{}, fmt.Errorf("invalid address in %s", s)
+		}
+		return variable{name: name, addr: uint16(addr)}, nil
+	}
+	return variable{}, fmt.Errorf("unknown variable %s", s)
+}
+
+// String returns the name of v as written in scripts.
+func (v variable) String() string {
+	if v.name == "RAM" || v.name == "ROM" {
+		return fmt.Sprintf("%s[%d]", v.name, v.addr)
+	}
+	return v.name
+}
+
+// get returns the value of v in c. The values of 16-bit registers and memory are signed.
+func (v variable) get(c *cpu.CPU) int {
+	switch v.name {
+	case "A":
+		return int(int16(c.A()))
+	case "D":
+		return int(int16(c.D()))
+	case "PC":
+		return int(c.PC())
+	case "time":
+		return int(c.Cycles())
+	case "RAM":
+		return int(int16(c.RAM(v.addr)))
+	default:
+		return int(int16(c.ROM(v.addr)))
+	}
+}
+
+// set sets the value of v in c to val.
+func (v variable) set(c *cpu.CPU, val int) error {
+	w := uint16(val)
+	switch v.name {
+	case "A":
+		c.SetA(w)
+	case "D":
+		c.SetD(w)
+	case "PC":
+		c.SetPC(w)
+	case "RAM":
+		c.SetRAM(v.addr, w)
+	case "ROM":
+		c.SetROM(v.addr, w)
+	default:
+		return fmt.Errorf("%s cannot be set", v.name)
+	}
+	return nil
+}
+
+// parseValue parses s as a 16-bit value. s is a decimal number, or a hexadecimal, binary or
+// decimal number prefixed by %X, %B or %D respectively.
+func parseValue(s string) (int, error) {
+	base, digits := 10, s
+	if len(s) > 2 && s[0] == '%' {
+		switch s[1] {
+		case 'X':
+			base = 16
+		case 'B':
+			base = 2
+		case 'D':
+			base = 10
+		default:
+			return 0, fmt.Errorf("invalid value %s", s)
+		}
+		digits = s[2:]
+	}
+
+	n, err := strconv.ParseInt(digits, base, 32)
+	if err != nil || n < -0x8000 || n > 0xFFFF {
+		return 0, fmt.Errorf("invalid value %s", s)
+	}
+	return int(n), nil
+}
+
+// conds is a map of the comparison operators of while commands.
+var conds = map[string]func(x, y int) bool{
+	"=":  func(x, y int) bool { return x == y },
+	"<>": func(x, y int) bool { return x != y },
+	"<":  func(x, y int) bool { return x < y },
+	">":  func(x, y int) bool { return x > y },
+	"<=": func(x, y int) bool { return x <= y },
+	">=": func(x, y int) bool { return x >= y },
+}
+
+// column is a column of an output list, such as RAM[0]%D2.6.2.
+type column struct {
+	v                  variable
+	format             byte // B, X, D or S
+	left, width, right int  // paddings and the width of values
+}
+
+// parseColumn parses s as a column of an output list. The format is %B1.16.1 by default.
+func parseColumn(s string) (column, error) {
+	name, format := s, "B1.16.1"
+	if i := strings.IndexByte(s, '%'); i >= 0 {
+		name, format = s[:i], s[i+1:]
+	}
+	v, err := parseVar(name)
+	if err != nil {
+		return column{}, err
+	}
+
+	if format == "" || strings.IndexByte("BXDS", format[0]) < 0 {
+		return column{}, fmt.Errorf("invalid format %s", s)
+	}
+	col := column{v: v, format: format[0]}
+	nums := strings.Split(format[1:], ".")
+	if len(nums) != 3 {
+		return column{}, fmt.Errorf("invalid format %s", s)
+	}
+	for i, p := range []*int{&col.left, &col.width, &col.right} {
+		n, err := strconv.Atoi(nums[i])
+		if err != nil || n < 0 {
+			return column{}, fmt.Errorf("invalid format %s", s)
+		}
+		*p = n
+	}
+	return col, nil
+}
+
+// header returns the header line of cols, where the variable names are centered.
+func header(cols []column) string {
+	line := "|"
+	for _, col := range cols {
+		w := col.left + col.width + col.right
+		name := col.v.String()
+		if len(name) > w {
+			name = name[:w]
+		}
+		left := (w - len(name)) / 2
+		line += strings.Repeat(" ", left) + name + strings.Repeat(" ", w-left-len(name)) + "|"
+	}
+	return line
+}
+
+// row returns the line of the values of cols in c.
+func row(c *cpu.CPU, cols []column) string {
+	line := "|"
+	for _, col := range cols {
+		val := col.v.get(c)
+		var s string
+		switch col.format {
+		case 'B':
+			s = fmt.Sprintf("%016b", uint16(val))
+		case 'X':
+			s = fmt.Sprintf("%04X", uint16(val))
+		default:
+			s = strconv.Itoa(val)
+		}
+		if len(s) > col.width {
+			s = s[len(s)-col.width:]
+		}
+		line += strings.Repeat(" ", col.left+col.width-len(s)) + s + strings.Repeat(" ", col.right) + "|"
+	}
+	return line
+}
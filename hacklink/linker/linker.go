@@ -0,0 +1,188 @@
+package linker
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/skatsuta/nand2tetris/assembler/obj"
+	"github.com/skatsuta/nand2tetris/assembler/symbtbl"
+)
+
+const (
+	// romSize is the number of words in ROM.
+	romSize = 0x8000
+	// maxAddr is the maximum address that an A instruction can load.
+	maxAddr = 0x7FFF
+)
+
+// Error is an error found in linking objects.
+type Error struct {
+	Module string // name of the object in which the error is found
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	if e.Module == "" {
+		return e.Msg
+	}
+	return e.Module + ": " + e.Msg
+}
+
+// ErrorList is a list of errors found in linking objects.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0].Error(), len(l)-1)
+}
+
+// Linker combines relocatable objects into one program.
+type Linker struct {
+	objs  []*obj.Object
+	errs  ErrorList
+	symbs map[string]uint16 // exported labels
+	defs  map[string]string // names of the objects that export labels
+	vars  map[string]uint16 // allocated variables
+	next  int               // address of the next variable
+}
+
+// New creates a new Linker.
+func New() *Linker {
+	return &Linker{}
+}
+
+// Add adds an object o. Objects are placed in ROM in the order they are added,
+// so the first object contains the entry point of the program.
+func (l *Linker) Add(o *obj.Object) {
+	l.objs = append(l.objs, o)
+}
+
+// Link places the objects in ROM, resolves the symbols referred by them and
+// returns the machine code of the whole program.
+//
+// A symbol declared as external in an object must be exported by another object.
+// Other symbols left to the linker are variables, which must not have the name of
+// an exported label. Variables with the same name are shared among objects
+// and allocated from RAM address 0x10.
+//
+// Link reports all the duplicate, undefined and colliding symbols it finds as an ErrorList.
+func (l *Linker) Link() ([]uint16, error) {
+	l.errs = nil
+	l.symbs = make(map[string]uint16)
+	l.defs = make(map[string]string)
+	l.vars = make(map[string]uint16)
+	l.next = symbtbl.VarBase
+
+	// place objects and collect exported labels
+	bases := make([]int, len(l.objs))
+	size := 0
+	for i, o := range l.objs {
+		bases[i] = size
+		size += len(o.Words)
+	}
+	if size > romSize {
+		return nil, ErrorList{{Msg: fmt.Sprintf("program too large: %d words exceed ROM size %d", size, romSize)}}
+	}
+	for i, o := range l.objs {
+		for _, symb := range sortedKeys(o.Exports) {
+			if def, found := l.defs[symb]; found {
+				l.errorf(o.Name, "duplicate symbol %s, already defined in %s", symb, def)
+				continue
+			}
+			l.defs[symb] = o.Name
+			l.symbs[symb] = uint16(bases[i] + int(o.Exports[symb]))
+		}
+	}
+
+	// fix up words
+	words := make([]uint16, 0, size)
+	for i, o := range l.objs {
+		code := make([]uint16, len(o.Words))
+		copy(code, o.Words)
+
+		imports := make(map[string]bool, len(o.Imports))
+		for _, symb := range o.Imports {
+			imports[symb] = true
+		}
+		reported := make(map[string]bool)
+
+		for _, rel := range o.Relocs {
+			var v int
+			switch rel.Kind {
+			case obj.RelocROM:
+				v = int(code[rel.Index]) + bases[i]
+			case obj.RelocSymbol:
+				a, err := l.resolve(rel.Symbol, imports[rel.Symbol])
+				if err != "" {
+					if !reported[rel.Symbol] {
+						l.errorf(o.Name, "%s", err)
+						reported[rel.Symbol] = true
+					}
+					continue
+				}
+				v = a
+			}
+
+			if v > maxAddr {
+				l.errorf(o.Name, "relocated address %d of word %d out of range (0..%d)", v, rel.Index, maxAddr)
+				continue
+			}
+			code[rel.Index] = uint16(v)
+		}
+		words = append(words, code...)
+	}
+
+	if len(l.errs) > 0 {
+		return nil, l.errs
+	}
+	return words, nil
+}
+
+// resolve returns the address of symb. An external symbol is resolved to the label
+// exported by another object, and any other symbol is allocated as a variable.
+// If symb cannot be resolved, it returns an error message.
+func (l *Linker) resolve(symb string, external bool) (int, string) {
+	if external {
+		addr, found := l.symbs[symb]
+		if !found {
+			return 0, fmt.Sprintf("undefined symbol %s", symb)
+		}
+		return int(addr), ""
+	}
+
+	if def, found := l.defs[symb]; found {
+		return 0, fmt.Sprintf("variable %s collides with the label exported by %s", symb, def)
+	}
+	if addr, found := l.vars[symb]; found {
+		return int(addr), ""
+	}
+	if l.next >= symbtbl.VarLimit {
+		l.errorf("", "too many variables: %s cannot be allocated below 0x%04X", symb, symbtbl.VarLimit)
+		// report it only once
+		l.vars[symb] = 0
+		return 0, ""
+	}
+	l.vars[symb] = uint16(l.next)
+	l.next++
+	return int(l.vars[symb]), ""
+}
+
+// errorf adds an error found in the object named module.
+func (l *Linker) errorf(module, format string, args ...interface{}) {
+	l.errs = append(l.errs, &Error{Module: module, Msg: fmt.Sprintf(format, args...)})
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]uint16) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,121 @@
+package linker
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/skatsuta/nand2tetris/assembler/obj"
+	"github.com/skatsuta/nand2tetris/assembler/symbtbl"
+)
+
+func TestLink(t *testing.T) {
+	main := &obj.Object{
+		Name:    "main.asm",
+		Words:   []uint16{0, 0xEC10, 0, 0xE308, 0, 0xEA87, 6, 0xEA87},
+		Exports: map[string]uint16{"END": 6},
+		Imports: []string{"MULT"},
+		Relocs: []obj.Reloc{
+			{Index: 0, Kind: obj.RelocSymbol, Symbol: "x"},
+			{Index: 2, Kind: obj.RelocSymbol, Symbol: "y"},
+			{Index: 4, Kind: obj.RelocSymbol, Symbol: "MULT"},
+			{Index: 6, Kind: obj.RelocROM},
+		},
+	}
+	mult := &obj.Object{
+		Name:    "mult.asm",
+		Words:   []uint16{0, 0xFC10, 0, 1, 0},
+		Exports: map[string]uint16{"MULT": 0},
+		Imports: []string{"END"},
+		Relocs: []obj.Reloc{
+			{Index: 0, Kind: obj.RelocSymbol, Symbol: "y"},
+			{Index: 2, Kind: obj.RelocSymbol, Symbol: "z"},
+			{Index: 3, Kind: obj.RelocROM},
+			{Index: 4, Kind: obj.RelocSymbol, Symbol: "END"},
+		},
+	}
+
+	l := New()
+	l.Add(main)
+	l.Add(mult)
+	got, err := l.Link()
+	if err != nil {
+		t.Fatalf("Link failed: %s", err.Error())
+	}
+
+	want := []uint16{0x10, 0xEC10, 0x11, 0xE308, 8, 0xEA87, 6, 0xEA87, 0x11, 0xFC10, 0x12, 9, 6}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:  %v\nwant: %v", got, want)
+	}
+
+	// the words of the objects are left as they are
+	if main.Words[0] != 0 {
+		t.Errorf("the object should not be modified, but got %v", main.Words)
+	}
+}
+
+func TestLinkError(t *testing.T) {
+	a := &obj.Object{
+		Name:    "a.asm",
+		Words:   []uint16{0, 0, 0x7FFF},
+		Exports: map[string]uint16{"F": 0, "G": 1},
+		Imports: []string{"H"},
+		Relocs: []obj.Reloc{
+			{Index: 0, Kind: obj.RelocSymbol, Symbol: "H"},
+			{Index: 1, Kind: obj.RelocSymbol, Symbol: "H"},
+			{Index: 2, Kind: obj.RelocROM},
+		},
+	}
+	b := &obj.Object{
+		Name:    "b.asm",
+		Words:   []uint16{0, 0, 0},
+		Exports: map[string]uint16{"G": 0},
+		Relocs: []obj.Reloc{
+			// not external, so it is a variable colliding with the label exported by a.asm
+			{Index: 1, Kind: obj.RelocSymbol, Symbol: "F"},
+			{Index: 2, Kind: obj.RelocSymbol, Symbol: "F"},
+		},
+	}
+
+	l := New()
+	l.Add(b)
+	l.Add(a)
+	_, err := l.Link()
+
+	list, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("got %#v; want ErrorList", err)
+	}
+	var got []string
+	for _, e := range list {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		"a.asm: duplicate symbol G, already defined in b.asm",
+		"b.asm: variable F collides with the label exported by a.asm",
+		"a.asm: undefined symbol H",
+		"a.asm: relocated address 32770 of word 2 out of range (0..32767)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestLinkTooManyVariables(t *testing.T) {
+	o := &obj.Object{Name: "vars.asm"}
+	for i := 0; i < symbtbl.VarLimit-symbtbl.VarBase+1; i++ {
+		o.Words = append(o.Words, 0)
+		o.Relocs = append(o.Relocs, obj.Reloc{Index: i, Kind: obj.RelocSymbol, Symbol: fmt.Sprintf("v%d", i)})
+	}
+
+	l := New()
+	l.Add(o)
+	_, err := l.Link()
+	if err == nil {
+		t.Fatal("Link should fail")
+	}
+	want := "too many variables: v16368 cannot be allocated below 0x4000"
+	if msg := err.Error(); msg != want {
+		t.Errorf("got %q; want %q", msg, want)
+	}
+}
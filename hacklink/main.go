@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/skatsuta/nand2tetris/assembler/asm"
+	"github.com/skatsuta/nand2tetris/assembler/obj"
+	"github.com/skatsuta/nand2tetris/hacklink/linker"
+)
+
+var (
+	appName = "hacklink"
+	usage   = "Usage: %s [-o out] [-f format] file.obj [files...]"
+)
+
+var (
+	// output is a name of the output file.
+	output = flag.String("o", "", "write the program into `file` (default: the first object with the extension of the format)")
+	// format is a name of the output format.
+	format = flag.String("f", "hack", "output `format`: "+strings.Join(asm.FormatNames(), ", "))
+)
+
+func init() {
+	flag.Usage = func() {
+		printErr(usage, appName)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, found := asm.LookupFormat(*format)
+	if !found {
+		printErr("unknown output format: %s", *format)
+		os.Exit(2)
+	}
+
+	if e := link(args, f); e != nil {
+		printErr("%s", errMsg(e))
+		os.Exit(1)
+	}
+}
+
+// printErr prints an formatted error message in os.Stderr.
+func printErr(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// link links the object files paths and writes the program in the format f.
+func link(paths []string, f asm.Format) error {
+	l := linker.New()
+	for _, path := range paths {
+		o, err := readObject(path)
+		if err != nil {
+			return err
+		}
+		l.Add(o)
+	}
+
+	words, err := l.Link()
+	if err != nil {
+		return err
+	}
+
+	name := *output
+	if name == "" {
+		name = outPath(paths[0], f.Ext())
+	}
+	out, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if e := f.Write(out, words); e != nil {
+		_ = out.Close()
+		return fmt.Errorf("failed to write %s: %s", name, e.Error())
+	}
+	return out.Close()
+}
+
+// readObject reads an object file path.
+func readObject(path string) (*obj.Object, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	o, err := obj.Read(in)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	if o.Name == "" {
+		o.Name = path
+	}
+	return o, nil
+}
+
+// errMsg returns an error message of err. If err is a list of errors, it returns all of them.
+func errMsg(err error) string {
+	list, ok := err.(linker.ErrorList)
+	if !ok {
+		return err.Error()
+	}
+
+	msgs := make([]string, len(list))
+	for i, e := range list {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// outPath returns a new output file name path with the given new extension name.
+// For example, if path is "/foo/bar/baz.old" and newExt is "new", it returns "/foo/bar/baz.new".
+func outPath(path string, newExt string) string {
+	oldExt := filepath.Ext(path)
+	return path[:len(path)-len(oldExt)] + "." + newExt
+}
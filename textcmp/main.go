@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/skatsuta/nand2tetris/textcmp/table"
+)
+
+var (
+	appName = "textcmp"
+	usage   = "Usage: %s [-max n] file.out file.cmp"
+)
+
+var (
+	// max is the maximum number of differing lines printed.
+	max = flag.Int("max", 10, "print at most `n` differing lines (0 for all)")
+)
+
+func init() {
+	flag.Usage = func() {
+		printErr(usage, appName)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	diffs, err := compare(args[0], args[1])
+	if err != nil {
+		printErr("%s", err.Error())
+		os.Exit(2)
+	}
+	if len(diffs) == 0 {
+		fmt.Println("Comparison ended successfully")
+		return
+	}
+
+	for i, d := range diffs {
+		if *max > 0 && i == *max {
+			fmt.Printf("... and %d more\n", len(diffs)-i)
+			break
+		}
+		fmt.Printf("%s\n\n", d.String())
+	}
+	printErr("Comparison failure: %d lines differ", len(diffs))
+	os.Exit(1)
+}
+
+// printErr prints an formatted error message in os.Stderr.
+func printErr(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// compare compares the output file outPath with the compare file cmpPath.
+func compare(outPath, cmpPath string) ([]table.Diff, error) {
+	out, err := os.Open(outPath)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	cmp, err := os.Open(cmpPath)
+	if err != nil {
+		return nil, err
+	}
+	defer cmp.Close()
+
+	return table.Compare(out, cmp)
+}
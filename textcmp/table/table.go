@@ -0,0 +1,201 @@
+// Package table compares the tables in output files (.out) with the ones in compare files (.cmp)
+// of the official tools, and describes their differences by columns.
+package table
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Cells splits a line of a table into the cells between |s, with white spaces removed.
+// A line that does not start with | is a single cell, and an empty line has no cells.
+func Cells(line string) []string {
+	s := strings.Join(strings.Fields(line), "")
+	if s == "" {
+		return nil
+	}
+	if !strings.HasPrefix(s, "|") {
+		return []string{s}
+	}
+	s = strings.TrimSuffix(s[1:], "|")
+	return strings.Split(s, "|")
+}
+
+// isWildcard reports whether the cell in a compare file matches any value, i.e. it consists of *s.
+func isWildcard(cell string) bool {
+	return cell != "" && strings.Trim(cell, "*") == ""
+}
+
+// Match compares a line of an output file with a line of a compare file, ignoring white spaces.
+// A cell of *s in the compare line matches any value. If the lines have the same number of cells,
+// it also returns the indexes of the differing cells.
+func Match(out, cmp string) (bool, []int) {
+	oc, cc := Cells(out), Cells(cmp)
+	if len(oc) != len(cc) {
+		return false, nil
+	}
+
+	var cols []int
+	for i := range oc {
+		if oc[i] != cc[i] && !isWildcard(cc[i]) {
+			cols = append(cols, i)
+		}
+	}
+	return len(cols) == 0, cols
+}
+
+// Diff is a line of an output file that differs from the line of a compare file.
+type Diff struct {
+	Line   int    // line number starting at 1
+	Header string // first line of the compare file, which has the column names
+	Out    string // line of the output file, or "" if the output file has ended
+	Cmp    string // line of the compare file, or "" if the compare file has ended
+	Cols   []int  // indexes of the differing cells, or nil if the numbers of cells differ
+}
+
+// Compare compares the lines of an output file read from out with the ones of a compare file
+// read from cmp, and returns all the differing lines.
+func Compare(out, cmp io.Reader) ([]Diff, error) {
+	outLines, err := readLines(out)
+	if err != nil {
+		return nil, err
+	}
+	cmpLines, err := readLines(cmp)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(outLines)
+	if len(cmpLines) > n {
+		n = len(cmpLines)
+	}
+	var header string
+	if len(cmpLines) > 0 {
+		header = cmpLines[0]
+	}
+
+	var diffs []Diff
+	for i := 0; i < n; i++ {
+		o, c := lineAt(outLines, i), lineAt(cmpLines, i)
+		if ok, cols := Match(o, c); !ok {
+			diffs = append(diffs, Diff{Line: i + 1, Header: header, Out: o, Cmp: c, Cols: cols})
+		}
+	}
+	return diffs, nil
+}
+
+// Names returns the names of the differing columns of d. A column without a name in the header
+// is shown by its number starting at 1.
+func (d *Diff) Names() []string {
+	hdr := Cells(d.Header)
+	names := make([]string, len(d.Cols))
+	for i, col := range d.Cols {
+		if len(hdr) == len(Cells(d.Out)) && hdr[col] != "" {
+			names[i] = hdr[col]
+		} else {
+			names[i] = fmt.Sprintf("column %d", col+1)
+		}
+	}
+	return names
+}
+
+// Time returns the value of the time column of d, or "" if the table has no time column.
+func (d *Diff) Time() string {
+	hdr, oc := Cells(d.Header), Cells(d.Out)
+	if d.Line == 1 || len(hdr) != len(oc) {
+		return ""
+	}
+	for i, name := range hdr {
+		if name == "time" {
+			return oc[i]
+		}
+	}
+	return ""
+}
+
+// String returns a description of d. If the lines have the same number of cells, it shows
+// the header, the output line and the compare line with their columns aligned, and marks
+// the differing columns with ^s.
+func (d *Diff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "line %d", d.Line)
+	if t := d.Time(); t != "" {
+		fmt.Fprintf(&b, ", time %s", t)
+	}
+
+	if d.Cols == nil {
+		fmt.Fprintf(&b, ": lines differ\n  output:  %s\n  compare: %s", orNone(d.Out), orNone(d.Cmp))
+		return b.String()
+	}
+
+	names := d.Names()
+	if len(names) == 1 {
+		fmt.Fprintf(&b, ": column %s differs", names[0])
+	} else {
+		fmt.Fprintf(&b, ": columns %s differ", strings.Join(names, ", "))
+	}
+
+	rows := [][]string{Cells(d.Out), Cells(d.Cmp)}
+	labels := []string{"output", "compare"}
+	if hdr := Cells(d.Header); d.Line > 1 && len(hdr) == len(rows[0]) {
+		rows = append([][]string{hdr}, rows...)
+		labels = append([]string{""}, labels...)
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	for i, row := range rows {
+		fmt.Fprintf(&b, "\n  %-7s |", labels[i])
+		for j, cell := range row {
+			fmt.Fprintf(&b, " %-*s |", widths[j], cell)
+		}
+	}
+
+	marks := make([]string, len(widths))
+	for i, w := range widths {
+		marks[i] = strings.Repeat(" ", w+3)
+	}
+	for _, col := range d.Cols {
+		marks[col] = strings.Repeat("^", widths[col]+2) + " "
+	}
+	b.WriteString("\n" + strings.TrimRight(strings.Repeat(" ", 11)+strings.Join(marks, ""), " "))
+	return b.String()
+}
+
+// orNone returns line, or a placeholder if line is empty.
+func orNone(line string) string {
+	if line == "" {
+		return "(no line)"
+	}
+	return line
+}
+
+// lineAt returns the i-th line of lines, or "" if lines has fewer lines.
+func lineAt(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return ""
+}
+
+// readLines reads all the lines from r.
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if e := sc.Err(); e != nil {
+		return nil, fmt.Errorf("failed to read input: %s", e.Error())
+	}
+	return lines, nil
+}
@@ -0,0 +1,137 @@
+package table
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCells(t *testing.T) {
+	cellsTests := []struct {
+		line string
+		want []string
+	}{
+		{"|  RAM[0]  | RAM[256] |", []string{"RAM[0]", "RAM[256]"}},
+		{"|0+  |     0|  0  |", []string{"0+", "0", "0"}},
+		{"| a | |", []string{"a", ""}},
+		{"|a|b", []string{"a", "b"}},
+		{"End of script", []string{"Endofscript"}},
+		{"  ", nil},
+	}
+
+	for _, tt := range cellsTests {
+		got := Cells(tt.line)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") || len(got) != len(tt.want) {
+			t.Errorf("Cells(%q): got = %q; want = %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	matchTests := []struct {
+		out, cmp string
+		ok       bool
+		cols     []int
+	}{
+		{"|     257  |      15  |", "|257|15|", true, nil},
+		{"|     257  |      15  |", "|     257  |      16  |", false, []int{1}},
+		{"| 1 | 2 | 3 |", "| 0 | 2 | 0 |", false, []int{0, 2}},
+		{"|1+  |  11111|", "|1+  |*******|", true, nil},
+		{"|1+  |  11111|", "|1+  |   *   |", true, nil},
+		{"| 1 | 2 |", "| 1 |", false, nil},
+		{"| 1 |", "", false, nil},
+	}
+
+	for _, tt := range matchTests {
+		ok, cols := Match(tt.out, tt.cmp)
+		if ok != tt.ok || len(cols) != len(tt.cols) {
+			t.Errorf("Match(%q, %q): got = %v %v; want = %v %v", tt.out, tt.cmp, ok, cols, tt.ok, tt.cols)
+			continue
+		}
+		for i := range cols {
+			if cols[i] != tt.cols[i] {
+				t.Errorf("Match(%q, %q): got = %v; want = %v", tt.out, tt.cmp, cols, tt.cols)
+			}
+		}
+	}
+}
+
+const testCmp = `|time| inM  |reset| outM  | pc  |
+|0+  |     0|  0  |*******|    0|
+|1   |     0|  0  |*******|    1|
+|1+  | 11111|  0  |     -1|    1|
+`
+
+func TestCompare(t *testing.T) {
+	out := `| time |  inM   | reset |  outM   |  pc   |
+|0+    |      0 |   0   |       0 |     0 |
+|1     |      0 |   0   |       0 |     2 |
+|1+    |  11111 |   0   |      -2 |     2 |
+|2     |  11111 |   0   |       0 |     3 |
+`
+	diffs, err := Compare(strings.NewReader(out), strings.NewReader(testCmp))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		line  int
+		time  string
+		names string
+	}{
+		{3, "1", "pc"},
+		{4, "1+", "outM,pc"},
+		{5, "2", ""},
+	}
+	if len(diffs) != len(want) {
+		t.Fatalf("the number of diffs: got = %d; want = %d", len(diffs), len(want))
+	}
+	for i, w := range want {
+		d := diffs[i]
+		if names := strings.Join(d.Names(), ","); d.Line != w.line || d.Time() != w.time || names != w.names {
+			t.Errorf("diff %d: got = line %d, time %q, %s; want = line %d, time %q, %s",
+				i, d.Line, d.Time(), names, w.line, w.time, w.names)
+		}
+	}
+}
+
+func TestDiffString(t *testing.T) {
+	diffStringTests := []struct {
+		diff Diff
+		want string
+	}{
+		{
+			Diff{Line: 4, Header: "|time| inM  |reset| outM  | pc  |",
+				Out: "|1+  | 11111|  0  |     -2|    2|", Cmp: "|1+  | 11111|  0  |     -1|    1|", Cols: []int{3, 4}},
+			`line 4, time 1+: columns outM, pc differ
+          | time | inM   | reset | outM | pc |
+  output  | 1+   | 11111 | 0     | -2   | 2  |
+  compare | 1+   | 11111 | 0     | -1   | 1  |
+                                  ^^^^^^ ^^^^`,
+		},
+		{
+			Diff{Line: 1, Header: "|  RAM[0]  |", Out: "|  RAM[1]  |", Cmp: "|  RAM[0]  |", Cols: []int{0}},
+			`line 1: column RAM[0] differs
+  output  | RAM[1] |
+  compare | RAM[0] |
+           ^^^^^^^^`,
+		},
+		{
+			Diff{Line: 2, Header: "| a |", Out: "| 1 | 2 |", Cmp: "| 1 |", Cols: nil},
+			`line 2: lines differ
+  output:  | 1 | 2 |
+  compare: | 1 |`,
+		},
+		{
+			Diff{Line: 3, Header: "| a |", Out: "", Cmp: "| 1 |", Cols: nil},
+			`line 3: lines differ
+  output:  (no line)
+  compare: | 1 |`,
+		},
+	}
+
+	for _, tt := range diffStringTests {
+		if got := tt.diff.String(); got != tt.want {
+			t.Errorf("got = \n%s\nwant = \n%s", got, tt.want)
+		}
+	}
+}
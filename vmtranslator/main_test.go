@@ -2,8 +2,11 @@ package main
 
 import (
 	"io/ioutil"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/skatsuta/nand2tetris/hackemu/tst"
 )
 
 func TestConvert(t *testing.T) {
@@ -36,6 +39,40 @@ func TestConvert(t *testing.T) {
 	}
 }
 
+func TestScripts(t *testing.T) {
+	testCases := []string{
+		"../projects/07/StackArithmetic/SimpleAdd/SimpleAdd",
+		"../projects/07/StackArithmetic/StackTest/StackTest",
+		"../projects/07/MemoryAccess/BasicTest/BasicTest",
+		"../projects/07/MemoryAccess/PointerTest/PointerTest",
+		"../projects/07/MemoryAccess/StaticTest/StaticTest",
+		"../projects/08/ProgramFlow/BasicLoop/BasicLoop",
+		"../projects/08/ProgramFlow/FibonacciSeries/FibonacciSeries",
+	}
+
+	for _, path := range testCases {
+		// translate a copy of the sources so that the committed .asm files are left untouched
+		dir := t.TempDir()
+		for _, ext := range []string{".vm", ".tst", ".cmp"} {
+			b, err := ioutil.ReadFile(path + ext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e := ioutil.WriteFile(filepath.Join(dir, filepath.Base(path)+ext), b, 0644); e != nil {
+				t.Fatal(e)
+			}
+		}
+
+		tmp := filepath.Join(dir, filepath.Base(path))
+		if e := convert(tmp + ".vm"); e != nil {
+			t.Fatal(e)
+		}
+		if e := tst.RunFile(tmp + ".tst"); e != nil {
+			t.Errorf("%s.tst: %s", path, e)
+		}
+	}
+}
+
 func TestOutpath(t *testing.T) {
 	testCases := []struct {
 		path  string